@@ -0,0 +1,184 @@
+// Package anomaly 扫描考勤记录，标记疑似代打卡和位置伪造的异常，供管理员复核
+package anomaly
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"greentech-attendance/config"
+)
+
+// 异常类型
+const (
+	KindIdenticalCheckIn = "identical_check_in"
+	KindImpossibleTravel = "impossible_travel"
+	KindUnusualDevice    = "unusual_device"
+	KindLastSecond       = "last_second_check_in"
+)
+
+var Kinds = []string{KindIdenticalCheckIn, KindImpossibleTravel, KindUnusualDevice, KindLastSecond}
+
+// 严重程度
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// baselineDays 判断陌生 IP/设备时参考的历史天数
+const baselineDays = 30
+
+// Detector 按规则扫描考勤记录并写入 attendance_anomalies，同一异常只记录一次
+type Detector struct {
+	DB        *sql.DB
+	WorkStart string
+}
+
+func New(db *sql.DB, cfg *config.Config) *Detector {
+	return &Detector{DB: db, WorkStart: cfg.WorkStartTime}
+}
+
+// record 扫描用的考勤记录
+type record struct {
+	ID          int
+	UserID      int
+	CheckIn     time.Time
+	CheckOut    *time.Time
+	InLocation  string
+	OutLocation string
+	InIP        string
+	InDevice    string
+}
+
+// finding 规则命中的异常，Fingerprint 用于去重
+type finding struct {
+	Kind            string
+	Severity        string
+	UserID          int
+	RecordID        int
+	RelatedUserID   int
+	RelatedRecordID int
+	Day             time.Time
+	Fingerprint     string
+	Details         map[string]interface{}
+}
+
+// StartNightlyScan 每天在 at（HH:MM）扫描前一天的考勤记录
+func (d *Detector) StartNightlyScan(at string) {
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		log.Printf("invalid anomaly scan time %q, job disabled", at)
+		return
+	}
+
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			yesterday := next.AddDate(0, 0, -1)
+			if _, err := d.Scan(yesterday, yesterday); err != nil {
+				log.Printf("anomaly scan failed: %v", err)
+			}
+		}
+	}()
+}
+
+// Scan 扫描签到日期在 [from, to] 内的记录，返回新标记或更新的异常数。
+// 已复核的异常不会被重新打开
+func (d *Detector) Scan(from, to time.Time) (int, error) {
+	// 额外加载之前的记录作为陌生设备和月内卡点签到的参考
+	loadFrom := from.AddDate(0, 0, -baselineDays)
+	if monthStart := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location()); monthStart.Before(loadFrom) {
+		loadFrom = monthStart
+	}
+	records, err := d.loadRecords(loadFrom, to)
+	if err != nil {
+		return 0, err
+	}
+
+	inRange := func(r record) bool {
+		day := r.CheckIn.Format("2006-01-02")
+		return day >= from.Format("2006-01-02") && day <= to.Format("2006-01-02")
+	}
+
+	findings := []finding{}
+	findings = append(findings, identicalCheckIns(records, inRange)...)
+	findings = append(findings, impossibleTravel(records, inRange)...)
+	findings = append(findings, unusualDevices(records, inRange)...)
+	findings = append(findings, lastSecondCheckIns(records, inRange, d.WorkStart)...)
+
+	flagged := 0
+	for _, f := range findings {
+		n, err := d.save(f)
+		if err != nil {
+			return flagged, err
+		}
+		flagged += n
+	}
+	return flagged, nil
+}
+
+func (d *Detector) loadRecords(from, to time.Time) ([]record, error) {
+	rows, err := d.DB.Query(`
+		SELECT id, user_id, check_in_time, check_out_time,
+			   COALESCE(check_in_location, ''), COALESCE(check_out_location, ''),
+			   COALESCE(check_in_ip, ''), COALESCE(check_in_device, '')
+		FROM attendance_records
+		WHERE DATE(check_in_time) BETWEEN $1 AND $2
+		ORDER BY check_in_time
+	`, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []record{}
+	for rows.Next() {
+		var r record
+		var checkOut sql.NullTime
+		err := rows.Scan(&r.ID, &r.UserID, &r.CheckIn, &checkOut, &r.InLocation, &r.OutLocation, &r.InIP, &r.InDevice)
+		if err != nil {
+			return nil, err
+		}
+		if checkOut.Valid {
+			r.CheckOut = &checkOut.Time
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+func (d *Detector) save(f finding) (int, error) {
+	details, err := json.Marshal(f.Details)
+	if err != nil {
+		return 0, err
+	}
+	var relatedUser, relatedRecord interface{}
+	if f.RelatedUserID != 0 {
+		relatedUser = f.RelatedUserID
+	}
+	if f.RelatedRecordID != 0 {
+		relatedRecord = f.RelatedRecordID
+	}
+	result, err := d.DB.Exec(`
+		INSERT INTO attendance_anomalies
+			(kind, severity, user_id, attendance_record_id, related_user_id, related_record_id, detected_on, fingerprint, details)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (fingerprint) DO UPDATE
+		SET severity = EXCLUDED.severity, attendance_record_id = EXCLUDED.attendance_record_id,
+			details = EXCLUDED.details, updated_at = CURRENT_TIMESTAMP
+		WHERE attendance_anomalies.status = 'open' AND attendance_anomalies.details <> EXCLUDED.details
+	`, f.Kind, f.Severity, f.UserID, f.RecordID, relatedUser, relatedRecord, f.Day.Format("2006-01-02"), f.Fingerprint, details)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,287 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// 不同用户签到位置完全相同且间隔不超过该时长时视为疑似代打卡
+	identicalLocationWindow = 60 * time.Second
+	// 不同用户从同一 IP、同一设备签到且间隔不超过该时长时视为疑似代打卡；
+	// 同一办公网络出口 IP 相同很常见，所以时间窗口更短
+	identicalDeviceWindow = 10 * time.Second
+	// 两个位置之间距离达到该值才判断移动速度，避免定位漂移误报
+	travelMinDistanceKm  = 50.0
+	travelMediumSpeedKmh = 300.0
+	travelHighSpeedKmh   = 900.0
+	// 用户在参考期内至少有这么多次带 IP 的签到，才判断陌生 IP/设备
+	baselineMinCheckIns = 5
+	// 班次开始前该时长内签到视为卡点签到，每月达到次数后标记
+	lastSecondWindow      = 2 * time.Minute
+	lastSecondLowCount    = 3
+	lastSecondMediumCount = 5
+)
+
+// sameCoordinates 两个位置都能解析为经纬度时按20米以内判断，否则要求文本完全相同
+func sameCoordinates(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	lat1, lng1, ok1 := parseLocation(a)
+	lat2, lng2, ok2 := parseLocation(b)
+	if ok1 && ok2 {
+		return distanceKm(lat1, lng1, lat2, lng2) <= 0.02
+	}
+	return a == b
+}
+
+// identicalCheckIns 标记不同用户在几乎同一时刻从同一位置或同一设备签到的记录
+func identicalCheckIns(records []record, inRange func(record) bool) []finding {
+	findings := []finding{}
+	for i, a := range records {
+		if !inRange(a) {
+			continue
+		}
+		for _, b := range records[i+1:] {
+			gap := b.CheckIn.Sub(a.CheckIn)
+			if gap > identicalLocationWindow {
+				break
+			}
+			if a.UserID == b.UserID {
+				continue
+			}
+			locationMatch := sameCoordinates(a.InLocation, b.InLocation)
+			deviceMatch := a.InIP != "" && a.InIP == b.InIP && a.InDevice == b.InDevice && gap <= identicalDeviceWindow
+			if !locationMatch && !deviceMatch {
+				continue
+			}
+			// 同一办公室内多人同时到岗很常见，仅位置相同只作为低风险提示
+			severity := SeverityLow
+			if deviceMatch {
+				severity = SeverityMedium
+			}
+			if locationMatch && deviceMatch {
+				severity = SeverityHigh
+			}
+			findings = append(findings, finding{
+				Kind:            KindIdenticalCheckIn,
+				Severity:        severity,
+				UserID:          a.UserID,
+				RecordID:        a.ID,
+				RelatedUserID:   b.UserID,
+				RelatedRecordID: b.ID,
+				Day:             a.CheckIn,
+				Fingerprint:     fmt.Sprintf("%s:%d:%d", KindIdenticalCheckIn, a.ID, b.ID),
+				Details: map[string]interface{}{
+					"seconds_apart":    gap.Seconds(),
+					"location_match":   locationMatch,
+					"device_match":     deviceMatch,
+					"location":         a.InLocation,
+					"related_location": b.InLocation,
+					"ip":               a.InIP,
+					"related_ip":       b.InIP,
+					"check_in_time":    a.CheckIn,
+					"related_check_in": b.CheckIn,
+				},
+			})
+		}
+	}
+	return findings
+}
+
+type point struct {
+	recordID int
+	event    string
+	at       time.Time
+	location string
+	lat, lng float64
+}
+
+// impossibleTravel 按用户的签到、签退位置顺序计算移动速度，标记超出交通工具可能速度的移动
+func impossibleTravel(records []record, inRange func(record) bool) []finding {
+	byUser := map[int][]point{}
+	flaggable := map[int]bool{}
+	for _, r := range records {
+		flaggable[r.ID] = inRange(r)
+		if lat, lng, ok := parseLocation(r.InLocation); ok {
+			byUser[r.UserID] = append(byUser[r.UserID], point{r.ID, "check_in", r.CheckIn, r.InLocation, lat, lng})
+		}
+		if r.CheckOut == nil {
+			continue
+		}
+		if lat, lng, ok := parseLocation(r.OutLocation); ok {
+			byUser[r.UserID] = append(byUser[r.UserID], point{r.ID, "check_out", *r.CheckOut, r.OutLocation, lat, lng})
+		}
+	}
+
+	findings := []finding{}
+	for userID, points := range byUser {
+		sort.Slice(points, func(i, j int) bool { return points[i].at.Before(points[j].at) })
+		for i := 1; i < len(points); i++ {
+			prev, cur := points[i-1], points[i]
+			if !flaggable[cur.recordID] {
+				continue
+			}
+			distance := distanceKm(prev.lat, prev.lng, cur.lat, cur.lng)
+			if distance < travelMinDistanceKm {
+				continue
+			}
+			hours := cur.at.Sub(prev.at).Hours()
+			speed := math.Inf(1)
+			if hours > 0 {
+				speed = distance / hours
+			}
+			if speed < travelMediumSpeedKmh {
+				continue
+			}
+			severity := SeverityMedium
+			if speed >= travelHighSpeedKmh {
+				severity = SeverityHigh
+			}
+			details := map[string]interface{}{
+				"from_event":    prev.event,
+				"from_location": prev.location,
+				"from_time":     prev.at,
+				"to_event":      cur.event,
+				"to_location":   cur.location,
+				"to_time":       cur.at,
+				"distance_km":   math.Round(distance*10) / 10,
+				"hours":         math.Round(hours*100) / 100,
+			}
+			if !math.IsInf(speed, 1) {
+				details["speed_kmh"] = math.Round(speed)
+			}
+			f := finding{
+				Kind:        KindImpossibleTravel,
+				Severity:    severity,
+				UserID:      userID,
+				RecordID:    cur.recordID,
+				Day:         cur.at,
+				Fingerprint: fmt.Sprintf("%s:%d:%s:%d:%s", KindImpossibleTravel, prev.recordID, prev.event, cur.recordID, cur.event),
+				Details:     details,
+			}
+			if prev.recordID != cur.recordID {
+				f.RelatedRecordID = prev.recordID
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// unusualDevices 标记从该用户近30天未使用过的 IP 或设备签到的记录
+func unusualDevices(records []record, inRange func(record) bool) []finding {
+	byUser := map[int][]record{}
+	for _, r := range records {
+		if r.InIP != "" {
+			byUser[r.UserID] = append(byUser[r.UserID], r)
+		}
+	}
+
+	findings := []finding{}
+	for userID, history := range byUser {
+		for i, r := range history {
+			if !inRange(r) {
+				continue
+			}
+			ips, devices := map[string]bool{}, map[string]bool{}
+			count := 0
+			since := r.CheckIn.AddDate(0, 0, -baselineDays)
+			for _, prev := range history[:i] {
+				if prev.CheckIn.Before(since) {
+					continue
+				}
+				ips[prev.InIP] = true
+				devices[prev.InDevice] = true
+				count++
+			}
+			if count < baselineMinCheckIns {
+				continue
+			}
+			newIP, newDevice := !ips[r.InIP], !devices[r.InDevice]
+			if !newIP && !newDevice {
+				continue
+			}
+			severity := SeverityLow
+			if newIP && newDevice {
+				severity = SeverityMedium
+			}
+			findings = append(findings, finding{
+				Kind:        KindUnusualDevice,
+				Severity:    severity,
+				UserID:      userID,
+				RecordID:    r.ID,
+				Day:         r.CheckIn,
+				Fingerprint: fmt.Sprintf("%s:%d", KindUnusualDevice, r.ID),
+				Details: map[string]interface{}{
+					"ip":              r.InIP,
+					"device":          r.InDevice,
+					"new_ip":          newIP,
+					"new_device":      newDevice,
+					"baseline_checks": count,
+				},
+			})
+		}
+	}
+	return findings
+}
+
+// lastSecondCheckIns 按用户按月统计班次开始前2分钟内的签到，达到次数后标记一条，以当月最近一次为准
+func lastSecondCheckIns(records []record, inRange func(record) bool, workStart string) []finding {
+	start, err := time.Parse("15:04", workStart)
+	if err != nil {
+		start, _ = time.Parse("15:04", "09:00")
+	}
+
+	type key struct {
+		userID int
+		month  string
+	}
+	hits := map[key][]record{}
+	touched := map[key]bool{}
+	for _, r := range records {
+		k := key{r.UserID, r.CheckIn.Format("2006-01")}
+		if inRange(r) {
+			touched[k] = true
+		}
+		shiftStart := time.Date(r.CheckIn.Year(), r.CheckIn.Month(), r.CheckIn.Day(), start.Hour(), start.Minute(), 0, 0, r.CheckIn.Location())
+		// 迟到按分钟判断，开始时间当分钟内签到仍算准时
+		if r.CheckIn.Before(shiftStart.Add(-lastSecondWindow)) || !r.CheckIn.Before(shiftStart.Add(time.Minute)) {
+			continue
+		}
+		hits[k] = append(hits[k], r)
+	}
+
+	findings := []finding{}
+	for k, list := range hits {
+		if !touched[k] || len(list) < lastSecondLowCount {
+			continue
+		}
+		severity := SeverityLow
+		if len(list) >= lastSecondMediumCount {
+			severity = SeverityMedium
+		}
+		latest := list[len(list)-1]
+		times := make([]string, len(list))
+		for i, r := range list {
+			times[i] = r.CheckIn.Format("2006-01-02 15:04:05")
+		}
+		findings = append(findings, finding{
+			Kind:        KindLastSecond,
+			Severity:    severity,
+			UserID:      k.userID,
+			RecordID:    latest.ID,
+			Day:         latest.CheckIn,
+			Fingerprint: fmt.Sprintf("%s:%d:%s", KindLastSecond, k.userID, k.month),
+			Details: map[string]interface{}{
+				"month":          k.month,
+				"count":          len(list),
+				"check_in_times": times,
+			},
+		})
+	}
+	return findings
+}
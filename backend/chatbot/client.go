@@ -0,0 +1,82 @@
+package chatbot
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Channel 一个部门的群机器人配置，日报和审批提醒的范围包含其下级部门
+type Channel struct {
+	ID           int
+	DepartmentID int
+	Department   string
+	Provider     string
+	WebhookURL   string
+	// Secret 钉钉加签密钥，其他平台忽略
+	Secret string
+	// ApproversOnly 群成员都是审批人，审批提醒中可以显示请假类型
+	ApproversOnly bool
+}
+
+// Post 将消息发送到群机器人
+func Post(client *http.Client, channel Channel, msg Message) error {
+	body, err := Format(channel.Provider, msg)
+	if err != nil {
+		return err
+	}
+
+	target := channel.WebhookURL
+	if channel.Provider == ProviderDingTalk && channel.Secret != "" {
+		target, err = signDingTalk(target, channel.Secret, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := client.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("chat webhook returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	// 企业微信和钉钉出错时仍返回200，通过 errcode 判断
+	var result struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if json.Unmarshal(respBody, &result) == nil && result.ErrCode != nil && *result.ErrCode != 0 {
+		return fmt.Errorf("chat webhook error %d: %s", *result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// signDingTalk 按钉钉加签规则在URL上附加 timestamp 和 sign
+func signDingTalk(webhookURL, secret string, now time.Time) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", err
+	}
+	timestamp := strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+
+	q := u.Query()
+	q.Set("timestamp", timestamp)
+	q.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
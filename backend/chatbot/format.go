@@ -0,0 +1,97 @@
+package chatbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 支持的群机器人类型
+const (
+	ProviderWeCom    = "wecom"
+	ProviderDingTalk = "dingtalk"
+	ProviderSlack    = "slack"
+)
+
+// Message 与平台无关的消息内容，由各平台的格式化函数转换为请求体
+type Message struct {
+	Title    string
+	Lines    []string
+	Link     string
+	LinkText string
+}
+
+type formatter func(Message) ([]byte, error)
+
+var formatters = map[string]formatter{
+	ProviderWeCom:    formatWeCom,
+	ProviderDingTalk: formatDingTalk,
+	ProviderSlack:    formatSlack,
+}
+
+// ValidProvider 判断是否支持该平台
+func ValidProvider(provider string) bool {
+	_, ok := formatters[provider]
+	return ok
+}
+
+// Format 按平台生成群机器人 incoming webhook 的请求体
+func Format(provider string, msg Message) ([]byte, error) {
+	f, ok := formatters[provider]
+	if !ok {
+		return nil, fmt.Errorf("unsupported chat provider: %s", provider)
+	}
+	return f(msg)
+}
+
+// markdown 企业微信和钉钉共用的 Markdown 正文
+func markdown(msg Message) string {
+	var b strings.Builder
+	b.WriteString("### " + msg.Title + "\n")
+	for _, line := range msg.Lines {
+		b.WriteString("> " + line + "\n")
+	}
+	if msg.Link != "" {
+		b.WriteString(fmt.Sprintf("\n[%s](%s)", linkText(msg), msg.Link))
+	}
+	return b.String()
+}
+
+func linkText(msg Message) string {
+	if msg.LinkText != "" {
+		return msg.LinkText
+	}
+	return "查看详情"
+}
+
+func formatWeCom(msg Message) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"content": markdown(msg),
+		},
+	})
+}
+
+func formatDingTalk(msg Message) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": msg.Title,
+			"text":  markdown(msg),
+		},
+	})
+}
+
+// formatSlack 使用 Slack 的 mrkdwn 语法，链接格式为 <url|text>
+func formatSlack(msg Message) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("*" + msg.Title + "*\n")
+	for _, line := range msg.Lines {
+		b.WriteString("• " + line + "\n")
+	}
+	if msg.Link != "" {
+		b.WriteString(fmt.Sprintf("<%s|%s>", msg.Link, linkText(msg)))
+	}
+	return json.Marshal(map[string]string{"text": b.String()})
+}
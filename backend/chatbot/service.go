@@ -0,0 +1,262 @@
+package chatbot
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"greentech-attendance/config"
+	"greentech-attendance/models"
+)
+
+// 群机器人可订阅的消息类型
+const (
+	EventDailyDigest   = "daily_digest"
+	EventLeaveApproval = "leave_approval"
+)
+
+var Events = []string{EventDailyDigest, EventLeaveApproval}
+
+// Service 向部门群发送考勤日报和待审批提醒
+type Service struct {
+	DB        *sql.DB
+	Client    *http.Client
+	BaseURL   string
+	WorkStart string
+}
+
+func New(db *sql.DB, cfg *config.Config) *Service {
+	return &Service{
+		DB:        db,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+		BaseURL:   strings.TrimRight(cfg.AppBaseURL, "/"),
+		WorkStart: cfg.WorkStartTime,
+	}
+}
+
+const channelColumns = `id, COALESCE(department_id, 0), department, provider, webhook_url, COALESCE(secret, ''), approvers_only`
+
+func scanChannels(rows *sql.Rows) ([]Channel, error) {
+	defer rows.Close()
+	channels := []Channel{}
+	for rows.Next() {
+		var ch Channel
+		if err := rows.Scan(&ch.ID, &ch.DepartmentID, &ch.Department, &ch.Provider, &ch.WebhookURL, &ch.Secret, &ch.ApproversOnly); err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+// LoadChannel 按ID读取群机器人配置（不论是否启用），用于测试发送
+func (s *Service) LoadChannel(id interface{}) (Channel, error) {
+	var ch Channel
+	err := s.DB.QueryRow(`SELECT `+channelColumns+` FROM chat_channels WHERE id = $1`, id).Scan(
+		&ch.ID, &ch.DepartmentID, &ch.Department, &ch.Provider, &ch.WebhookURL, &ch.Secret, &ch.ApproversOnly,
+	)
+	return ch, err
+}
+
+// Send 发送消息到群，失败时返回错误
+func (s *Service) Send(channel Channel, msg Message) error {
+	return Post(s.Client, channel, msg)
+}
+
+// NotifyLeaveApproval 将待审批的请假申请发到申请人所在部门及其上级部门的群，附带审批页面链接。
+// 消息不含请假原因，只有审批人群才显示具体请假类型，其他群统一显示为「请假」
+func (s *Service) NotifyLeaveApproval(requestID int) {
+	if s == nil {
+		return
+	}
+	var name, leaveType string
+	var departmentID sql.NullInt64
+	var startDate, endDate time.Time
+	var days float64
+	err := s.DB.QueryRow(`
+		SELECT u.name, u.department_id, l.leave_type, l.start_date, l.end_date, l.days
+		FROM leave_requests l
+		JOIN users u ON u.id = l.user_id
+		WHERE l.id = $1
+	`, requestID).Scan(&name, &departmentID, &leaveType, &startDate, &endDate, &days)
+	if err != nil {
+		log.Printf("load leave request %d for chat failed: %v", requestID, err)
+		return
+	}
+	if !departmentID.Valid {
+		return
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT `+channelColumns+` FROM chat_channels
+		WHERE active AND $2 = ANY(events)
+		  AND department_id IN (SELECT unnest(ancestors) FROM department_paths WHERE id = $1)
+	`, departmentID.Int64, EventLeaveApproval)
+	if err != nil {
+		log.Printf("load chat channels failed: %v", err)
+		return
+	}
+	channels, err := scanChannels(rows)
+	if err != nil {
+		log.Printf("load chat channels failed: %v", err)
+		return
+	}
+
+	for _, ch := range channels {
+		typeName := "请假"
+		if ch.ApproversOnly {
+			if label, ok := models.LeaveTypeNames["zh"][leaveType]; ok {
+				typeName = label
+			}
+		}
+		msg := Message{
+			Title: fmt.Sprintf("待审批：%s的%s申请", name, typeName),
+			Lines: []string{
+				fmt.Sprintf("时间：%s 至 %s，共%g天", startDate.Format("2006-01-02"), endDate.Format("2006-01-02"), days),
+			},
+			Link:     fmt.Sprintf("%s/dashboard/leave-manage?id=%d", s.BaseURL, requestID),
+			LinkText: "去审批",
+		}
+		if err := s.Send(ch, msg); err != nil {
+			log.Printf("post leave approval to chat channel %d failed: %v", ch.ID, err)
+		}
+	}
+}
+
+// StartDigestJob 每分钟检查一次，到达频道设定时间且当天未发送时发送考勤日报
+func (s *Service) StartDigestJob() {
+	go func() {
+		for {
+			now := time.Now()
+			if err := s.sendDueDigests(now); err != nil {
+				log.Printf("chat digest job failed: %v", err)
+			}
+			time.Sleep(time.Until(now.Truncate(time.Minute).Add(time.Minute)))
+		}
+	}()
+}
+
+func (s *Service) sendDueDigests(now time.Time) error {
+	today := now.Format("2006-01-02")
+	rows, err := s.DB.Query(`
+		SELECT `+channelColumns+` FROM chat_channels
+		WHERE active AND $1 = ANY(events) AND digest_time <= $2
+		  AND (last_digest_on IS NULL OR last_digest_on < $3)
+	`, EventDailyDigest, now.Format("15:04"), today)
+	if err != nil {
+		return err
+	}
+	channels, err := scanChannels(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range channels {
+		// 先标记再发送，发送失败不在当天重复刷屏
+		if _, err := s.DB.Exec(`UPDATE chat_channels SET last_digest_on = $1 WHERE id = $2`, today, ch.ID); err != nil {
+			return err
+		}
+		workday, err := s.isWorkday(now)
+		if err != nil {
+			return err
+		}
+		if !workday {
+			continue
+		}
+		if err := s.SendDigest(ch, now); err != nil {
+			log.Printf("post digest to chat channel %d failed: %v", ch.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) isWorkday(day time.Time) (bool, error) {
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		return false, nil
+	}
+	var holiday bool
+	err := s.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM holidays WHERE date = $1)`, day.Format("2006-01-02")).Scan(&holiday)
+	return !holiday, err
+}
+
+// SendDigest 发送部门当天的考勤日报
+func (s *Service) SendDigest(channel Channel, day time.Time) error {
+	msg, err := s.Digest(channel.DepartmentID, channel.Department, day)
+	if err != nil {
+		return err
+	}
+	return s.Send(channel, msg)
+}
+
+// Digest 统计部门（包含下级部门）某天的签到、迟到、出差、请假和未签到人员，department 为标题中的部门名称。
+// 出差视同出勤，计入已到人数
+func (s *Service) Digest(departmentID int, department string, day time.Time) (Message, error) {
+	date := day.Format("2006-01-02")
+	rows, err := s.DB.Query(`
+		SELECT u.name, a.check_in_time, (
+			SELECT l.leave_type FROM leave_requests l
+			WHERE l.user_id = u.id AND l.status IN ('approved', 'cancel_pending')
+			  AND $2::date BETWEEN l.start_date AND l.end_date
+			ORDER BY l.leave_type = 'business_trip' DESC, l.id LIMIT 1
+		)
+		FROM users u
+		LEFT JOIN attendance_records a ON a.user_id = u.id AND DATE(a.check_in_time) = $2::date
+		WHERE u.department_id IN (SELECT id FROM department_paths WHERE $1 = ANY(ancestors))
+		ORDER BY u.name
+	`, departmentID, date)
+	if err != nil {
+		return Message{}, err
+	}
+	defer rows.Close()
+
+	workStart, _ := time.Parse("15:04", s.WorkStart)
+	total := 0
+	present := 0
+	late, onTrip, onLeave, missing := []string{}, []string{}, []string{}, []string{}
+	for rows.Next() {
+		var name string
+		var checkInTime sql.NullTime
+		var leaveType sql.NullString
+		if err := rows.Scan(&name, &checkInTime, &leaveType); err != nil {
+			return Message{}, err
+		}
+		total++
+		switch {
+		case checkInTime.Valid:
+			present++
+			t := checkInTime.Time
+			if t.Hour()*60+t.Minute() > workStart.Hour()*60+workStart.Minute() {
+				late = append(late, name)
+			}
+		case leaveType.String == "business_trip":
+			present++
+			onTrip = append(onTrip, name)
+		case leaveType.Valid:
+			onLeave = append(onLeave, name)
+		default:
+			missing = append(missing, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Message{}, err
+	}
+
+	lines := []string{fmt.Sprintf("应到 %d 人，实到 %d 人", total, present)}
+	lines = append(lines, summaryLine("迟到", late), summaryLine("出差", onTrip),
+		summaryLine("请假", onLeave), summaryLine("未签到", missing))
+	return Message{
+		Title: fmt.Sprintf("%s %s 考勤日报", department, date),
+		Lines: lines,
+		Link:  s.BaseURL + "/dashboard/attendance-manage",
+	}, nil
+}
+
+func summaryLine(label string, names []string) string {
+	if len(names) == 0 {
+		return fmt.Sprintf("%s 0 人", label)
+	}
+	return fmt.Sprintf("%s %d 人：%s", label, len(names), strings.Join(names, "、"))
+}
@@ -0,0 +1,45 @@
+// httpsink 本地调试用的HTTP接收端，替代企业微信/钉钉/Slack群机器人和Webhook接收方：
+// 打印收到的请求并返回成功响应。
+//
+//	go run ./cmd/httpsink -addr :9099
+//
+// 之后将群机器人或Webhook地址配置为 http://localhost:9099/任意路径。
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+)
+
+func main() {
+	addr := flag.String("addr", ":9099", "listen address")
+	status := flag.Int("status", http.StatusOK, "response status code, e.g. 500 to test retries")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		keys := make([]string, 0, len(r.Header))
+		for k := range r.Header {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		log.Printf("%s %s", r.Method, r.URL.RequestURI())
+		for _, k := range keys {
+			log.Printf("  %s: %s", k, r.Header.Get(k))
+		}
+		log.Printf("  %s", body)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(*status)
+		// 企业微信/钉钉的成功响应格式，Slack 会忽略
+		io.WriteString(w, `{"errcode":0,"errmsg":"ok"}`)
+	})
+
+	log.Printf("http sink listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -15,10 +15,49 @@ type Config struct {
 	DBSSLMode       string
 	JWTSecret       string
 	JWTExpiresHours int
+	// 同一部门同一天允许请假的最大人数，0表示不限制
+	MaxDeptAbsence int
+	// 附件存储：local 或 s3
+	StorageDriver      string
+	StorageLocalDir    string
+	S3Endpoint         string
+	S3Region           string
+	S3Bucket           string
+	S3AccessKey        string
+	S3SecretKey        string
+	AttachmentMaxBytes int64
+	// 班次工作时间（HH:MM），用于按小时请假的计算
+	WorkStartTime  string
+	WorkEndTime    string
+	BreakStartTime string
+	BreakEndTime   string
+	// 邮件通知（SMTP_HOST 为空时只发站内通知）
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	// 前端地址，用于生成通知中的链接
+	AppBaseURL string
+	// 每天检查前一日未签退记录的时间（HH:MM）
+	MissingCheckOutTime string
+	// 每天扫描前一日考勤异常的时间（HH:MM）
+	AnomalyScanTime string
+	// 上班后/下班后多少分钟提醒未签到/未签退的员工，0表示不提醒
+	CheckInReminderMinutes  int
+	CheckOutReminderMinutes int
+	// 计为无薪假的请假类型，逗号分隔
+	UnpaidLeaveTypes string
+	// 设备绑定模式：off 不检查；flag 未绑定设备可签到但标记；enforce 拒绝未绑定设备签到
+	DeviceBindingMode string
 }
 
 func LoadConfig() *Config {
 	expiresHours, _ := strconv.Atoi(getEnv("JWT_EXPIRES_HOURS", "24"))
+	maxDeptAbsence, _ := strconv.Atoi(getEnv("LEAVE_MAX_DEPT_ABSENCE", "0"))
+	attachmentMaxMB, _ := strconv.Atoi(getEnv("ATTACHMENT_MAX_MB", "10"))
+	checkInReminder, _ := strconv.Atoi(getEnv("CHECKIN_REMINDER_MINUTES", "15"))
+	checkOutReminder, _ := strconv.Atoi(getEnv("CHECKOUT_REMINDER_MINUTES", "30"))
 
 	return &Config{
 		Port:            getEnv("PORT", "8080"),
@@ -30,6 +69,38 @@ func LoadConfig() *Config {
 		DBSSLMode:       getEnv("DB_SSLMODE", "disable"),
 		JWTSecret:       getEnv("JWT_SECRET", "your-secret-key"),
 		JWTExpiresHours: expiresHours,
+		MaxDeptAbsence:  maxDeptAbsence,
+
+		StorageDriver:      getEnv("STORAGE_DRIVER", "local"),
+		StorageLocalDir:    getEnv("STORAGE_LOCAL_DIR", "./uploads"),
+		S3Endpoint:         getEnv("S3_ENDPOINT", "http://localhost:9000"),
+		S3Region:           getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:           getEnv("S3_BUCKET", "greentech-attachments"),
+		S3AccessKey:        getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:        getEnv("S3_SECRET_KEY", ""),
+		AttachmentMaxBytes: int64(attachmentMaxMB) << 20,
+
+		WorkStartTime:  getEnv("WORK_START_TIME", "09:00"),
+		WorkEndTime:    getEnv("WORK_END_TIME", "18:00"),
+		BreakStartTime: getEnv("BREAK_START_TIME", "12:00"),
+		BreakEndTime:   getEnv("BREAK_END_TIME", "13:00"),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "25"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "noreply@greentech.local"),
+
+		AppBaseURL:          getEnv("APP_BASE_URL", "http://localhost:3000"),
+		MissingCheckOutTime: getEnv("MISSING_CHECKOUT_TIME", "09:00"),
+		AnomalyScanTime:     getEnv("ANOMALY_SCAN_TIME", "02:30"),
+
+		CheckInReminderMinutes:  checkInReminder,
+		CheckOutReminderMinutes: checkOutReminder,
+
+		UnpaidLeaveTypes: getEnv("PAYROLL_UNPAID_LEAVE_TYPES", "personal"),
+
+		DeviceBindingMode: getEnv("DEVICE_BINDING_MODE", "flag"),
 	}
 }
 
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// NormalizeDepartmentName 规范部门名称：去掉首尾空白，中文之间的空白全部去掉，
+// 英文单词之间保留一个空格，例如「研发 部」与「研发部」视为同一部门
+func NormalizeDepartmentName(name string) string {
+	var b strings.Builder
+	prev := ""
+	for _, field := range strings.Fields(name) {
+		if prev != "" {
+			last, _ := utf8.DecodeLastRuneInString(prev)
+			first, _ := utf8.DecodeRuneInString(field)
+			if last < utf8.RuneSelf && first < utf8.RuneSelf {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(field)
+		prev = field
+	}
+	return b.String()
+}
+
+// migrateDepartments 把 users 和 chat_channels 中尚未关联部门的部门名称迁移到 departments 表，
+// 规范化后相同的名称合并为同一个顶级部门，并同步规范两者中的部门名称
+func migrateDepartments(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT department FROM users
+		WHERE department_id IS NULL AND COALESCE(TRIM(department), '') <> ''
+		UNION
+		SELECT department FROM chat_channels
+		WHERE department_id IS NULL AND TRIM(department) <> ''
+	`)
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, raw := range names {
+		name := NormalizeDepartmentName(raw)
+		if err := migrateDepartment(db, raw, name); err != nil {
+			return err
+		}
+	}
+	if len(names) > 0 {
+		log.Printf("✓ Migrated %d department names", len(names))
+	}
+	return nil
+}
+
+func migrateDepartment(db *sql.DB, raw, name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 同名部门已存在时优先关联到顶级部门
+	var id int
+	err = tx.QueryRow(`
+		SELECT id FROM departments WHERE name = $1 ORDER BY parent_id NULLS FIRST, id LIMIT 1
+	`, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow("INSERT INTO departments (name) VALUES ($1) RETURNING id", name).Scan(&id)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET department_id = $1, department = $2
+		WHERE department_id IS NULL AND department = $3
+	`, id, name, raw)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE chat_channels SET department_id = $1, department = $2
+		WHERE department_id IS NULL AND department = $3
+	`, id, name, raw)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
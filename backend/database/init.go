@@ -110,6 +110,20 @@ func InitDatabase(db *sql.DB) error {
 		log.Printf("Warning: could not add remark column: %v", err)
 	}
 
+	// 撤销/销假相关字段
+	_, err = db.Exec(`
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS balance_year INTEGER;
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS cancel_end_date DATE;
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS cancel_days DECIMAL(5,1);
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS cancel_reason TEXT;
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+		UPDATE leave_requests SET balance_year = EXTRACT(YEAR FROM updated_at)
+		WHERE status = 'approved' AND balance_year IS NULL;
+	`)
+	if err != nil {
+		log.Printf("Warning: could not add cancellation columns: %v", err)
+	}
+
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS leave_balances (
 			id SERIAL PRIMARY KEY,
@@ -128,6 +142,531 @@ func InitDatabase(db *sql.DB) error {
 	}
 	log.Println("✓ Leave balances table created")
 
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS approval_rules (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			leave_type VARCHAR(50),
+			min_days DECIMAL(5,1),
+			max_days DECIMAL(5,1),
+			priority INTEGER DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS approval_rule_steps (
+			id SERIAL PRIMARY KEY,
+			rule_id INTEGER REFERENCES approval_rules(id) ON DELETE CASCADE,
+			step_order INTEGER NOT NULL,
+			approver_type VARCHAR(20) NOT NULL,
+			approver_value VARCHAR(100),
+			UNIQUE(rule_id, step_order)
+		);
+		CREATE TABLE IF NOT EXISTS leave_approval_steps (
+			id SERIAL PRIMARY KEY,
+			leave_request_id INTEGER REFERENCES leave_requests(id) ON DELETE CASCADE,
+			step_order INTEGER NOT NULL,
+			approver_type VARCHAR(20) NOT NULL,
+			approver_value VARCHAR(100),
+			status VARCHAR(20) DEFAULT 'pending',
+			acted_by INTEGER REFERENCES users(id),
+			acted_at TIMESTAMP,
+			remark TEXT,
+			UNIQUE(leave_request_id, step_order)
+		);
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS current_step INTEGER DEFAULT 0;
+	`)
+	if err != nil {
+		return fmt.Errorf("create approval workflow tables failed: %v", err)
+	}
+	log.Println("✓ Approval workflow tables created")
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS approval_delegations (
+			id SERIAL PRIMARY KEY,
+			delegator_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			delegate_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			start_date DATE NOT NULL,
+			end_date DATE NOT NULL,
+			reason TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_delegations_delegate ON approval_delegations(delegate_id, start_date, end_date);
+		ALTER TABLE leave_approval_steps ADD COLUMN IF NOT EXISTS on_behalf_of INTEGER REFERENCES users(id);
+	`)
+	if err != nil {
+		return fmt.Errorf("create approval_delegations table failed: %v", err)
+	}
+	log.Println("✓ Approval delegations table created")
+
+	// 按小时请假：增加起止时间和小时数，并提高天数精度以容纳不足半天的时长
+	_, err = db.Exec(`
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS start_time TIMESTAMP;
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS end_time TIMESTAMP;
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS hours DECIMAL(6,2);
+		DO $$
+		BEGIN
+			IF EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_name='leave_requests' AND column_name='days' AND numeric_scale < 3
+			) THEN
+				ALTER TABLE leave_requests ALTER COLUMN days TYPE DECIMAL(7,3);
+				ALTER TABLE leave_requests ALTER COLUMN cancel_days TYPE DECIMAL(7,3);
+				ALTER TABLE leave_balances ALTER COLUMN annual_leave TYPE DECIMAL(7,3);
+				ALTER TABLE leave_balances ALTER COLUMN sick_leave TYPE DECIMAL(7,3);
+				ALTER TABLE leave_balances ALTER COLUMN personal_leave TYPE DECIMAL(7,3);
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		log.Printf("Warning: could not add hourly leave columns: %v", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS leave_request_charges (
+			id SERIAL PRIMARY KEY,
+			leave_request_id INTEGER REFERENCES leave_requests(id) ON DELETE CASCADE,
+			year INTEGER NOT NULL,
+			days DECIMAL(7,3) NOT NULL,
+			UNIQUE(leave_request_id, year)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create leave_request_charges table failed: %v", err)
+	}
+	log.Println("✓ Leave request charges table created")
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS leave_type_policies (
+			leave_type VARCHAR(50) PRIMARY KEY,
+			attachment_required_days DECIMAL(5,1),
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS leave_attachments (
+			id SERIAL PRIMARY KEY,
+			leave_request_id INTEGER REFERENCES leave_requests(id) ON DELETE CASCADE,
+			file_name VARCHAR(255) NOT NULL,
+			content_type VARCHAR(100) NOT NULL,
+			size BIGINT NOT NULL,
+			storage_key VARCHAR(255) NOT NULL,
+			uploaded_by INTEGER REFERENCES users(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_leave_attachments_request ON leave_attachments(leave_request_id);
+		ALTER TABLE leave_type_policies ADD COLUMN IF NOT EXISTS min_unit_hours DECIMAL(4,2);
+	`)
+	if err != nil {
+		return fmt.Errorf("create leave attachment tables failed: %v", err)
+	}
+	log.Println("✓ Leave attachment tables created")
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS holidays (
+			date DATE PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create holidays table failed: %v", err)
+	}
+	log.Println("✓ Holidays table created")
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS calendar_feed_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			feed_type VARCHAR(20) NOT NULL,
+			token VARCHAR(64) UNIQUE NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, feed_type)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create calendar_feed_tokens table failed: %v", err)
+	}
+	log.Println("✓ Calendar feed tokens table created")
+
+	_, err = db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS language VARCHAR(10) DEFAULT 'zh';
+
+		CREATE TABLE IF NOT EXISTS notifications (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			event VARCHAR(50) NOT NULL,
+			title VARCHAR(200) NOT NULL,
+			body TEXT,
+			link VARCHAR(255),
+			ref VARCHAR(100),
+			read_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at DESC);
+
+		CREATE TABLE IF NOT EXISTS notification_preferences (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			event VARCHAR(50) NOT NULL,
+			in_app BOOLEAN NOT NULL DEFAULT TRUE,
+			email BOOLEAN NOT NULL DEFAULT TRUE,
+			PRIMARY KEY (user_id, event)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create notification tables failed: %v", err)
+	}
+	log.Println("✓ Notification tables created")
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS outbox_events (
+			id SERIAL PRIMARY KEY,
+			event_type VARCHAR(50) NOT NULL,
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			dispatched_at TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox_events(id) WHERE dispatched_at IS NULL;
+
+		CREATE TABLE IF NOT EXISTS webhook_endpoints (
+			id SERIAL PRIMARY KEY,
+			url VARCHAR(500) NOT NULL,
+			secret VARCHAR(100) NOT NULL,
+			events TEXT[] NOT NULL,
+			description VARCHAR(200),
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id SERIAL PRIMARY KEY,
+			endpoint_id INTEGER NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+			event_id INTEGER NOT NULL REFERENCES outbox_events(id) ON DELETE CASCADE,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_status_code INTEGER,
+			last_response TEXT,
+			last_error TEXT,
+			delivered_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+	`)
+	if err != nil {
+		return fmt.Errorf("create webhook tables failed: %v", err)
+	}
+	log.Println("✓ Webhook tables created")
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS chat_channels (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			department VARCHAR(50) NOT NULL,
+			provider VARCHAR(20) NOT NULL,
+			webhook_url VARCHAR(500) NOT NULL,
+			secret VARCHAR(200),
+			events TEXT[] NOT NULL,
+			digest_time VARCHAR(5) NOT NULL DEFAULT '18:00',
+			last_digest_on DATE,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create chat_channels table failed: %v", err)
+	}
+	log.Println("✓ Chat channels table created")
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS payroll_periods (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			start_date DATE NOT NULL,
+			end_date DATE NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'open',
+			locked_at TIMESTAMP,
+			locked_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS payroll_templates (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			columns JSONB NOT NULL,
+			is_default BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create payroll tables failed: %v", err)
+	}
+	log.Println("✓ Payroll tables created")
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS timesheets (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			period_type VARCHAR(10) NOT NULL,
+			start_date DATE NOT NULL,
+			end_date DATE NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'submitted',
+			worked_hours DECIMAL(7,2) NOT NULL DEFAULT 0,
+			leave_days DECIMAL(6,3) NOT NULL DEFAULT 0,
+			note TEXT,
+			approver_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			remark TEXT,
+			submitted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			decided_at TIMESTAMP,
+			UNIQUE(user_id, start_date, end_date)
+		);
+
+		CREATE TABLE IF NOT EXISTS timesheet_days (
+			id SERIAL PRIMARY KEY,
+			timesheet_id INTEGER REFERENCES timesheets(id) ON DELETE CASCADE,
+			work_date DATE NOT NULL,
+			check_in_time TIMESTAMP,
+			check_out_time TIMESTAMP,
+			worked_hours DECIMAL(5,2) NOT NULL DEFAULT 0,
+			leave_days DECIMAL(6,3) NOT NULL DEFAULT 0
+		);
+
+		CREATE TABLE IF NOT EXISTS timesheet_allocations (
+			id SERIAL PRIMARY KEY,
+			timesheet_id INTEGER REFERENCES timesheets(id) ON DELETE CASCADE,
+			project VARCHAR(100) NOT NULL,
+			hours DECIMAL(6,2) NOT NULL,
+			note TEXT
+		);
+
+		-- 记录提交、审批和重新开放的操作，供审计查阅
+		CREATE TABLE IF NOT EXISTS timesheet_events (
+			id SERIAL PRIMARY KEY,
+			timesheet_id INTEGER REFERENCES timesheets(id) ON DELETE CASCADE,
+			action VARCHAR(20) NOT NULL,
+			actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			remark TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_timesheets_status ON timesheets(status);
+	`)
+	if err != nil {
+		return fmt.Errorf("create timesheet tables failed: %v", err)
+	}
+	log.Println("✓ Timesheet tables created")
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS projects (
+			id SERIAL PRIMARY KEY,
+			code VARCHAR(50) UNIQUE NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			cost_center VARCHAR(50),
+			client VARCHAR(100),
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		ALTER TABLE attendance_records ADD COLUMN IF NOT EXISTS project_id INTEGER REFERENCES projects(id);
+
+		-- 将一天的工作时长拆分到多个项目；没有拆分时全部计入签到时选择的项目
+		CREATE TABLE IF NOT EXISTS attendance_allocations (
+			id SERIAL PRIMARY KEY,
+			attendance_record_id INTEGER REFERENCES attendance_records(id) ON DELETE CASCADE,
+			project_id INTEGER NOT NULL REFERENCES projects(id),
+			hours DECIMAL(5,2) NOT NULL,
+			UNIQUE(attendance_record_id, project_id)
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("create project tables failed: %v", err)
+	}
+	log.Println("✓ Project tables created")
+
+	_, err = db.Exec(`
+		ALTER TABLE attendance_records ADD COLUMN IF NOT EXISTS check_in_ip VARCHAR(45);
+		ALTER TABLE attendance_records ADD COLUMN IF NOT EXISTS check_in_device VARCHAR(255);
+		ALTER TABLE attendance_records ADD COLUMN IF NOT EXISTS check_out_ip VARCHAR(45);
+		ALTER TABLE attendance_records ADD COLUMN IF NOT EXISTS check_out_device VARCHAR(255);
+
+		CREATE TABLE IF NOT EXISTS attendance_anomalies (
+			id SERIAL PRIMARY KEY,
+			kind VARCHAR(30) NOT NULL,
+			severity VARCHAR(10) NOT NULL,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			attendance_record_id INTEGER REFERENCES attendance_records(id) ON DELETE CASCADE,
+			related_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			related_record_id INTEGER REFERENCES attendance_records(id) ON DELETE SET NULL,
+			detected_on DATE NOT NULL,
+			fingerprint VARCHAR(200) UNIQUE NOT NULL,
+			details JSONB NOT NULL DEFAULT '{}',
+			status VARCHAR(20) NOT NULL DEFAULT 'open',
+			reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			reviewed_at TIMESTAMP,
+			review_note TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_attendance_anomalies_status ON attendance_anomalies(status, detected_on DESC);
+	`)
+	if err != nil {
+		return fmt.Errorf("create attendance_anomalies table failed: %v", err)
+	}
+	log.Println("✓ Attendance anomalies table created")
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_devices (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			fingerprint VARCHAR(128) NOT NULL,
+			name VARCHAR(100),
+			user_agent VARCHAR(255),
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			first_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			reviewed_at TIMESTAMP,
+			UNIQUE(user_id, fingerprint)
+		);
+
+		ALTER TABLE attendance_records ADD COLUMN IF NOT EXISTS device_fingerprint VARCHAR(128);
+		ALTER TABLE attendance_records ADD COLUMN IF NOT EXISTS device_flagged BOOLEAN NOT NULL DEFAULT FALSE;
+	`)
+	if err != nil {
+		return fmt.Errorf("create user_devices table failed: %v", err)
+	}
+	log.Println("✓ User devices table created")
+
+	_, err = db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS attendance_modes TEXT[] NOT NULL DEFAULT ARRAY['office'];
+		ALTER TABLE attendance_records ADD COLUMN IF NOT EXISTS mode VARCHAR(10) NOT NULL DEFAULT 'office';
+
+		-- 外勤签到后在客户现场的打卡，一天可以有多条
+		CREATE TABLE IF NOT EXISTS field_visits (
+			id SERIAL PRIMARY KEY,
+			attendance_record_id INTEGER REFERENCES attendance_records(id) ON DELETE CASCADE,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			location TEXT,
+			customer VARCHAR(200),
+			note TEXT,
+			visited_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_field_visits_record ON field_visits(attendance_record_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("create field_visits table failed: %v", err)
+	}
+	log.Println("✓ Attendance modes and field visits created")
+
+	_, err = db.Exec(`
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS destination VARCHAR(200);
+	`)
+	if err != nil {
+		return fmt.Errorf("add leave_requests destination failed: %v", err)
+	}
+	log.Println("✓ Business trip destination added")
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS departments (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			parent_id INTEGER REFERENCES departments(id) ON DELETE RESTRICT,
+			head_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		-- 同一上级部门下名称不能重复
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_departments_sibling_name ON departments(COALESCE(parent_id, 0), name);
+
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS department_id INTEGER REFERENCES departments(id) ON DELETE SET NULL;
+		CREATE INDEX IF NOT EXISTS idx_users_department_id ON users(department_id);
+
+		ALTER TABLE chat_channels ADD COLUMN IF NOT EXISTS department_id INTEGER REFERENCES departments(id) ON DELETE RESTRICT;
+		ALTER TABLE chat_channels ALTER COLUMN department TYPE VARCHAR(100);
+
+		-- 每个部门从根部门到自身的ID和名称路径，用于按子树筛选和按层级排序
+		CREATE OR REPLACE VIEW department_paths AS
+		WITH RECURSIVE tree AS (
+			SELECT id, name, parent_id, ARRAY[id] AS ancestors, ARRAY[name::text] AS path
+			FROM departments WHERE parent_id IS NULL
+			UNION ALL
+			SELECT d.id, d.name, d.parent_id, tree.ancestors || d.id, tree.path || d.name::text
+			FROM departments d JOIN tree ON d.parent_id = tree.id
+		)
+		SELECT id, name, parent_id, ancestors, path FROM tree;
+	`)
+	if err != nil {
+		return fmt.Errorf("create departments table failed: %v", err)
+	}
+	log.Println("✓ Departments table created")
+
+	_, err = db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS manager_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+		CREATE INDEX IF NOT EXISTS idx_users_manager_id ON users(manager_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("add users manager_id failed: %v", err)
+	}
+	log.Println("✓ Reporting lines added")
+
+	_, err = db.Exec(`
+		-- 群成员都是审批人时，审批提醒才显示具体请假类型
+		ALTER TABLE chat_channels ADD COLUMN IF NOT EXISTS approvers_only BOOLEAN NOT NULL DEFAULT FALSE
+	`)
+	if err != nil {
+		return fmt.Errorf("add chat_channels approvers_only failed: %v", err)
+	}
+	log.Println("✓ Chat channel approvers_only added")
+
+	_, err = db.Exec(`
+		ALTER TABLE timesheets ADD COLUMN IF NOT EXISTS trip_days INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE timesheet_days ADD COLUMN IF NOT EXISTS on_trip BOOLEAN NOT NULL DEFAULT FALSE;
+	`)
+	if err != nil {
+		return fmt.Errorf("add timesheet trip days failed: %v", err)
+	}
+	log.Println("✓ Timesheet trip days added")
+
+	_, err = db.Exec(`
+		-- 工时表的项目分配改为引用项目表，project 保留提交时的项目编号，早期记录只有该文本
+		ALTER TABLE timesheet_allocations ADD COLUMN IF NOT EXISTS project_id INTEGER REFERENCES projects(id);
+	`)
+	if err != nil {
+		return fmt.Errorf("add timesheet_allocations project_id failed: %v", err)
+	}
+	log.Println("✓ Timesheet allocation projects added")
+
+	_, err = db.Exec(`
+		-- 销假审批结果单独记录，approver_id/remark 保留原请假审批的结果
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS cancel_approver_id INTEGER REFERENCES users(id);
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS cancel_remark TEXT;
+		ALTER TABLE leave_requests ADD COLUMN IF NOT EXISTS cancel_decided_at TIMESTAMP;
+	`)
+	if err != nil {
+		return fmt.Errorf("add leave cancellation decision columns failed: %v", err)
+	}
+	log.Println("✓ Leave cancellation decision columns added")
+
+	// 为历史待审批申请补充默认的管理员审批环节
+	_, err = db.Exec(`
+		INSERT INTO leave_approval_steps (leave_request_id, step_order, approver_type, approver_value)
+		SELECT l.id, 0, 'role', 'admin' FROM leave_requests l
+		WHERE l.status = 'pending' AND NOT EXISTS (
+			SELECT 1 FROM leave_approval_steps s WHERE s.leave_request_id = l.id
+		)
+	`)
+	if err != nil {
+		log.Printf("Warning: could not backfill approval steps: %v", err)
+	}
+
 	_, err = db.Exec(`
 		CREATE INDEX IF NOT EXISTS idx_attendance_user_id ON attendance_records(user_id);
 		CREATE INDEX IF NOT EXISTS idx_attendance_date ON attendance_records(check_in_time);
@@ -161,5 +700,9 @@ func InitDatabase(db *sql.DB) error {
 		log.Println("✓ Default admin account created (username: admin, password: admin123)")
 	}
 
+	if err := migrateDepartments(db); err != nil {
+		return fmt.Errorf("migrate departments failed: %v", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,100 @@
+// Package export 以流式方式生成 CSV 和 XLSX 表格，逐行写出，不在内存中保留整张表
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writer 表格写入器，第一次调用 WriteRow 写入表头
+type Writer interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// New 按格式创建写入器，format 为 csv 或 xlsx
+func New(format string, w io.Writer, sheetName string) (Writer, error) {
+	switch format {
+	case "csv":
+		return NewCSVWriter(w)
+	case "xlsx":
+		return NewXLSXWriter(w, sheetName)
+	}
+	return nil, fmt.Errorf("unsupported export format: %s", format)
+}
+
+// ContentType 返回格式对应的 MIME 类型
+func ContentType(format string) string {
+	if format == "xlsx" {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// formatValue 将单元格的值转为文本，nil 输出为空
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case time.Time:
+		return val.Format("2006-01-02 15:04:05")
+	case *time.Time:
+		if val == nil {
+			return ""
+		}
+		return val.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(v)
+}
+
+// CSVWriter 写入带 UTF-8 BOM 的 CSV，Excel 打开时中文不会乱码
+type CSVWriter struct {
+	w *csv.Writer
+}
+
+func NewCSVWriter(w io.Writer) (*CSVWriter, error) {
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return nil, err
+	}
+	return &CSVWriter{w: csv.NewWriter(w)}, nil
+}
+
+// escapeFormula 在以公式字符开头的文本前加单引号，避免表格软件把用户填写的内容当作公式执行。
+// 数值类型不处理，负数仍按数字显示
+func escapeFormula(v interface{}) string {
+	text := formatValue(v)
+	if _, ok := v.(string); ok && text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func (c *CSVWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = escapeFormula(v)
+	}
+	if err := c.w.Write(record); err != nil {
+		return err
+	}
+	// csv.Writer 内部有缓冲，定期刷新让数据尽快发到客户端
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *CSVWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
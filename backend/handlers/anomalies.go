@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"greentech-attendance/anomaly"
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AnomalyHandler struct {
+	DB       *sql.DB
+	Detector *anomaly.Detector
+}
+
+type ScanAnomaliesRequest struct {
+	StartDate string `json:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" binding:"required"`
+}
+
+type ReviewAnomalyRequest struct {
+	Status string `json:"status" binding:"required,oneof=confirmed dismissed open"`
+	Note   string `json:"note"`
+}
+
+// 手动扫描单次最多覆盖的天数
+const maxAnomalyScanDays = 93
+
+// GetAnomalies 返回考勤异常报告，按严重程度和日期排序。
+// status 默认为 open，传 all 返回全部；可按 kind、severity、user_id、部门（含下级部门）和日期筛选
+func (h *AnomalyHandler) GetAnomalies(c *gin.Context) {
+	query := `
+		SELECT a.id, a.kind, a.severity, a.user_id, u.name, COALESCE(u.department, ''),
+			   a.attendance_record_id, a.related_user_id, COALESCE(ru.name, ''), a.related_record_id,
+			   a.detected_on, a.details, a.status, a.reviewed_by, a.reviewed_at, COALESCE(a.review_note, ''),
+			   a.created_at
+		FROM attendance_anomalies a
+		JOIN users u ON a.user_id = u.id
+		LEFT JOIN users ru ON a.related_user_id = ru.id
+		WHERE 1 = 1`
+	args := []interface{}{}
+	filter := func(condition, value string) {
+		if value == "" {
+			return
+		}
+		args = append(args, value)
+		query += fmt.Sprintf(" AND "+condition, len(args))
+	}
+
+	status := c.DefaultQuery("status", "open")
+	if status == "all" {
+		status = ""
+	}
+	filter("a.status = $%d", status)
+	filter("a.kind = $%d", c.Query("kind"))
+	filter("a.severity = $%d", c.Query("severity"))
+	filter("a.user_id::text = $%d", c.Query("user_id"))
+	if _, ok := departmentIDParam(c); !ok {
+		return
+	}
+	filter("u.department_id IN (SELECT id FROM department_paths WHERE $%d::int = ANY(ancestors))", c.Query("department_id"))
+	filter("a.detected_on >= $%d", c.Query("start_date"))
+	filter("a.detected_on <= $%d", c.Query("end_date"))
+	query += `
+		ORDER BY CASE a.severity WHEN 'high' THEN 0 WHEN 'medium' THEN 1 ELSE 2 END,
+				 a.detected_on DESC, a.id DESC`
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取考勤异常失败"})
+		return
+	}
+	defer rows.Close()
+
+	anomalies := []models.AttendanceAnomaly{}
+	for rows.Next() {
+		var a models.AttendanceAnomaly
+		var relatedUserID, relatedRecordID, reviewedBy sql.NullInt64
+		var detectedOn time.Time
+		var reviewedAt sql.NullTime
+		var details []byte
+		err := rows.Scan(
+			&a.ID, &a.Kind, &a.Severity, &a.UserID, &a.UserName, &a.UserDepartment,
+			&a.AttendanceRecordID, &relatedUserID, &a.RelatedUserName, &relatedRecordID,
+			&detectedOn, &details, &a.Status, &reviewedBy, &reviewedAt, &a.ReviewNote,
+			&a.CreatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		a.DetectedOn = detectedOn.Format("2006-01-02")
+		if relatedUserID.Valid {
+			id := int(relatedUserID.Int64)
+			a.RelatedUserID = &id
+		}
+		if relatedRecordID.Valid {
+			id := int(relatedRecordID.Int64)
+			a.RelatedRecordID = &id
+		}
+		if reviewedBy.Valid {
+			id := int(reviewedBy.Int64)
+			a.ReviewedBy = &id
+		}
+		if reviewedAt.Valid {
+			a.ReviewedAt = &reviewedAt.Time
+		}
+		json.Unmarshal(details, &a.Details)
+		anomalies = append(anomalies, a)
+	}
+
+	c.JSON(http.StatusOK, anomalies)
+}
+
+// ScanAnomalies 立即扫描指定期间，夜间任务只扫描前一天
+func (h *AnomalyHandler) ScanAnomalies(c *gin.Context) {
+	var req ScanAnomaliesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	from, err1 := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+	to, err2 := time.ParseInLocation("2006-01-02", req.EndDate, time.Local)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式错误"})
+		return
+	}
+	if to.Before(from) || to.Sub(from).Hours()/24 >= maxAnomalyScanDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("扫描期间无效，最多扫描%d天", maxAnomalyScanDays)})
+		return
+	}
+
+	flagged, err := h.Detector.Scan(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "扫描考勤异常失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "扫描完成", "flagged": flagged})
+}
+
+// ReviewAnomaly 管理员复核异常：confirmed 确认、dismissed 忽略，open 重新打开
+func (h *AnomalyHandler) ReviewAnomaly(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req ReviewAnomalyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var reviewer interface{} = userID
+	if req.Status == "open" {
+		reviewer = nil
+	}
+	result, err := h.DB.Exec(`
+		UPDATE attendance_anomalies
+		SET status = $1, reviewed_by = $2, review_note = $3,
+			reviewed_at = CASE WHEN $1 = 'open' THEN NULL ELSE CURRENT_TIMESTAMP END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, req.Status, reviewer, req.Note, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新考勤异常失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "考勤异常不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "复核成功"})
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ApprovalRuleHandler struct {
+	DB *sql.DB
+}
+
+type ApprovalRuleStepRequest struct {
+	ApproverType  string `json:"approver_type" binding:"required,oneof=manager line_manager department_head role user"`
+	ApproverValue string `json:"approver_value"`
+}
+
+type ApprovalRuleRequest struct {
+	Name      string                    `json:"name" binding:"required"`
+	LeaveType string                    `json:"leave_type"`
+	MinDays   *float64                  `json:"min_days"`
+	MaxDays   *float64                  `json:"max_days"`
+	Priority  int                       `json:"priority"`
+	Steps     []ApprovalRuleStepRequest `json:"steps" binding:"required,min=1,dive"`
+}
+
+func (h *ApprovalRuleHandler) GetApprovalRules(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT id, name, leave_type, min_days, max_days, priority, created_at, updated_at
+		FROM approval_rules
+		ORDER BY priority DESC, id
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审批规则失败"})
+		return
+	}
+	defer rows.Close()
+
+	rules := []models.ApprovalRule{}
+	for rows.Next() {
+		var rule models.ApprovalRule
+		var leaveType sql.NullString
+		var minDays, maxDays sql.NullFloat64
+		err := rows.Scan(
+			&rule.ID, &rule.Name, &leaveType, &minDays, &maxDays,
+			&rule.Priority, &rule.CreatedAt, &rule.UpdatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		rule.LeaveType = leaveType.String
+		if minDays.Valid {
+			rule.MinDays = &minDays.Float64
+		}
+		if maxDays.Valid {
+			rule.MaxDays = &maxDays.Float64
+		}
+		rules = append(rules, rule)
+	}
+	rows.Close()
+
+	for i := range rules {
+		steps, err := loadApprovalRuleSteps(h.DB, rules[i].ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审批规则失败"})
+			return
+		}
+		rules[i].Steps = steps
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *ApprovalRuleHandler) CreateApprovalRule(c *gin.Context) {
+	var req ApprovalRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validApprovalRule(req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	var ruleID int
+	err = tx.QueryRow(`
+		INSERT INTO approval_rules (name, leave_type, min_days, max_days, priority)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		RETURNING id
+	`, req.Name, req.LeaveType, req.MinDays, req.MaxDays, req.Priority).Scan(&ruleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建审批规则失败"})
+		return
+	}
+
+	if err := insertApprovalRuleSteps(tx, ruleID, req.Steps); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建审批环节失败"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "审批规则创建成功",
+		"id":      ruleID,
+	})
+}
+
+func (h *ApprovalRuleHandler) UpdateApprovalRule(c *gin.Context) {
+	id := c.Param("id")
+	var req ApprovalRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validApprovalRule(req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	var ruleID int
+	err = tx.QueryRow(`
+		UPDATE approval_rules
+		SET name = $1, leave_type = NULLIF($2, ''), min_days = $3, max_days = $4, priority = $5,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6
+		RETURNING id
+	`, req.Name, req.LeaveType, req.MinDays, req.MaxDays, req.Priority, id).Scan(&ruleID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "审批规则不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新审批规则失败"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM approval_rule_steps WHERE rule_id = $1", ruleID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新审批环节失败"})
+		return
+	}
+	if err := insertApprovalRuleSteps(tx, ruleID, req.Steps); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新审批环节失败"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "审批规则更新成功"})
+}
+
+func (h *ApprovalRuleHandler) DeleteApprovalRule(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.DB.Exec("DELETE FROM approval_rules WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除审批规则失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "审批规则不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+func validApprovalRule(req ApprovalRuleRequest) bool {
+	if req.MinDays != nil && req.MaxDays != nil && *req.MinDays >= *req.MaxDays {
+		return false
+	}
+	for _, step := range req.Steps {
+		if !validateApprovalStep(step.ApproverType, step.ApproverValue) {
+			return false
+		}
+	}
+	return true
+}
+
+func insertApprovalRuleSteps(tx *sql.Tx, ruleID int, steps []ApprovalRuleStepRequest) error {
+	for i, step := range steps {
+		_, err := tx.Exec(`
+			INSERT INTO approval_rule_steps (rule_id, step_order, approver_type, approver_value)
+			VALUES ($1, $2, $3, $4)
+		`, ruleID, i, step.ApproverType, step.ApproverValue)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"greentech-attendance/config"
+	"greentech-attendance/models"
+	"greentech-attendance/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AttachmentHandler struct {
+	DB      *sql.DB
+	Storage storage.Storage
+	Cfg     *config.Config
+}
+
+// 允许上传的附件类型，按扩展名对应实际检测到的内容类型
+var allowedAttachmentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+}
+
+// UploadAttachment 申请人为请假申请上传附件（如病假证明）
+func (h *AttachmentHandler) UploadAttachment(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+
+	var requestID, ownerID int
+	var status string
+	err := h.DB.QueryRow(`
+		SELECT id, user_id, status FROM leave_requests WHERE id = $1
+	`, id).Scan(&requestID, &ownerID, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "请假申请不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假申请失败"})
+		return
+	}
+
+	if ownerID != userID.(int) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作"})
+		return
+	}
+	if status != "pending" && status != "approved" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该申请当前状态不允许上传附件"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.Cfg.AttachmentMaxBytes+1<<20)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的文件"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > h.Cfg.AttachmentMaxBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("文件大小不能超过%dMB", h.Cfg.AttachmentMaxBytes>>20)})
+		return
+	}
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	contentType, ok := allowedAttachmentTypes[ext]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "仅支持PDF、JPG、PNG格式的文件"})
+		return
+	}
+
+	// 以文件内容而不是客户端声明的类型判断格式
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+	if http.DetectContentType(head[:n]) != contentType {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件内容与扩展名不符"})
+		return
+	}
+
+	token, err := randomHex(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存附件失败"})
+		return
+	}
+	key := fmt.Sprintf("leave/%d/%s%s", requestID, token, ext)
+	if err := h.Storage.Save(key, io.MultiReader(bytes.NewReader(head[:n]), file), header.Size, contentType); err != nil {
+		log.Printf("save attachment failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存附件失败"})
+		return
+	}
+
+	var attachmentID int
+	err = h.DB.QueryRow(`
+		INSERT INTO leave_attachments (leave_request_id, file_name, content_type, size, storage_key, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, requestID, filepath.Base(header.Filename), contentType, header.Size, key, userID).Scan(&attachmentID)
+	if err != nil {
+		h.Storage.Delete(key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存附件失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "附件上传成功",
+		"id":      attachmentID,
+	})
+}
+
+// GetAttachments 获取请假申请的附件列表，仅申请人和审批人可见
+func (h *AttachmentHandler) GetAttachments(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	allowed, err := canViewLeaveRequest(h.DB, id, userID.(int), role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查访问权限失败"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问"})
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT id, leave_request_id, file_name, content_type, size, uploaded_by, created_at
+		FROM leave_attachments
+		WHERE leave_request_id = $1
+		ORDER BY created_at
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取附件失败"})
+		return
+	}
+	defer rows.Close()
+
+	attachments := []models.LeaveAttachment{}
+	for rows.Next() {
+		var a models.LeaveAttachment
+		err := rows.Scan(&a.ID, &a.LeaveRequestID, &a.FileName, &a.ContentType, &a.Size, &a.UploadedBy, &a.CreatedAt)
+		if err != nil {
+			continue
+		}
+		attachments = append(attachments, a)
+	}
+
+	c.JSON(http.StatusOK, attachments)
+}
+
+// DownloadAttachment 下载附件，仅申请人和审批人可下载
+func (h *AttachmentHandler) DownloadAttachment(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	var requestID int
+	var fileName, contentType, key string
+	var size int64
+	err := h.DB.QueryRow(`
+		SELECT leave_request_id, file_name, content_type, size, storage_key
+		FROM leave_attachments WHERE id = $1
+	`, id).Scan(&requestID, &fileName, &contentType, &size, &key)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取附件失败"})
+		return
+	}
+
+	allowed, err := canViewLeaveRequest(h.DB, requestID, userID.(int), role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查访问权限失败"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问"})
+		return
+	}
+
+	rc, err := h.Storage.Open(key)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件文件不存在"})
+		return
+	}
+	if err != nil {
+		log.Printf("open attachment failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取附件失败"})
+		return
+	}
+	defer rc.Close()
+
+	c.DataFromReader(http.StatusOK, size, contentType, rc, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": fileName}),
+	})
+}
+
+// DeleteAttachment 删除附件，申请人仅可在待审批时删除
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	var uploadedBy int
+	var key, status string
+	err := h.DB.QueryRow(`
+		SELECT a.uploaded_by, a.storage_key, l.status
+		FROM leave_attachments a
+		JOIN leave_requests l ON l.id = a.leave_request_id
+		WHERE a.id = $1
+	`, id).Scan(&uploadedBy, &key, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取附件失败"})
+		return
+	}
+
+	if role != "admin" && (uploadedBy != userID.(int) || status != "pending") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权删除该附件"})
+		return
+	}
+
+	if _, err := h.DB.Exec("DELETE FROM leave_attachments WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除附件失败"})
+		return
+	}
+	if err := h.Storage.Delete(key); err != nil {
+		log.Printf("delete attachment file %s failed: %v", key, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// randomHex 生成n字节的随机十六进制字符串
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
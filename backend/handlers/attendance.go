@@ -2,26 +2,59 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 	"time"
 
+	"greentech-attendance/config"
 	"greentech-attendance/models"
+	"greentech-attendance/notify"
+	"greentech-attendance/presence"
+	"greentech-attendance/webhook"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AttendanceHandler struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Cfg      *config.Config
+	Notifier *notify.Notifier
+	Presence *presence.Bus
 }
 
 type CheckInRequest struct {
 	Location string `json:"location"`
+	// 考勤方式：office 办公室（默认）、remote 远程、field 外勤
+	Mode       string `json:"mode"`
+	ProjectID  *int   `json:"project_id"`
+	DeviceID   string `json:"device_id"`
+	DeviceName string `json:"device_name"`
 }
 
 type CheckOutRequest struct {
 	Location string `json:"location"`
 }
 
+type CorrectionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// attendanceModeNames 考勤方式的中文名称，用于导出
+var attendanceModeNames = map[string]string{
+	"office": "办公室",
+	"remote": "远程",
+	"field":  "外勤",
+}
+
+// deviceOf 以 User-Agent 作为签到设备标识，用于异常检测
+func deviceOf(c *gin.Context) string {
+	ua := []rune(c.Request.UserAgent())
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+	return string(ua)
+}
+
 func (h *AttendanceHandler) CheckIn(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	var req CheckInRequest
@@ -39,23 +72,115 @@ func (h *AttendanceHandler) CheckIn(c *gin.Context) {
 		return
 	}
 
+	now := time.Now()
+	if !checkPayrollUnlocked(c, h.DB, now, now) {
+		return
+	}
+	if !checkTimesheetUnlocked(c, h.DB, userID, now) {
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = "office"
+	}
+	if _, ok := attendanceModeNames[req.Mode]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "考勤方式无效"})
+		return
+	}
+	var modeAllowed bool
+	err = h.DB.QueryRow("SELECT $2 = ANY(attendance_modes) FROM users WHERE id = $1", userID, req.Mode).Scan(&modeAllowed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取考勤方式失败"})
+		return
+	}
+	if !modeAllowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("不允许以「%s」方式签到", attendanceModeNames[req.Mode])})
+		return
+	}
+	if req.ProjectID != nil {
+		var active bool
+		err := h.DB.QueryRow("SELECT active FROM projects WHERE id = $1", *req.ProjectID).Scan(&active)
+		if err == sql.ErrNoRows || (err == nil && !active) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "项目不存在或已停用"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取项目失败"})
+			return
+		}
+	}
+
+	fingerprint := deviceFingerprint(c, req.DeviceID)
+	deviceFlagged := false
+	if h.Cfg.DeviceBindingMode != "off" {
+		deviceStatus, err := resolveDevice(h.DB, userID, fingerprint, req.DeviceName, deviceOf(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查签到设备失败"})
+			return
+		}
+		if deviceStatus != "approved" && h.Cfg.DeviceBindingMode == "enforce" {
+			message := "该设备尚未绑定，已提交绑定申请，请等待管理员审批"
+			if deviceStatus == "revoked" {
+				message = "该设备的绑定已被撤销，不能用于签到"
+			}
+			c.JSON(http.StatusForbidden, gin.H{"error": message, "device_status": deviceStatus})
+			return
+		}
+		deviceFlagged = deviceStatus != "approved"
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	checkInTime := time.Now()
 	var recordID int
-	err = h.DB.QueryRow(`
-		INSERT INTO attendance_records (user_id, check_in_time, check_in_location)
-		VALUES ($1, $2, $3)
+	err = tx.QueryRow(`
+		INSERT INTO attendance_records
+			(user_id, check_in_time, check_in_location, project_id, check_in_ip, check_in_device, device_fingerprint, device_flagged, mode)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id
-	`, userID, time.Now(), req.Location).Scan(&recordID)
+	`, userID, checkInTime, req.Location, req.ProjectID, c.ClientIP(), deviceOf(c), fingerprint, deviceFlagged, req.Mode).Scan(&recordID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "签到失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":       "签到成功",
+	err = webhook.Enqueue(tx, webhook.EventAttendanceCheckedIn, gin.H{
 		"record_id":     recordID,
-		"check_in_time": time.Now().Format("2006-01-02 15:04:05"),
+		"user_id":       userID,
+		"check_in_time": checkInTime,
+		"location":      req.Location,
+		"project_id":    req.ProjectID,
+		"mode":          req.Mode,
 	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "签到失败"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+	publishPresence(h.DB, h.Presence, presence.Event{
+		Type: presence.EventCheckIn, UserID: userID.(int), Status: "in", Time: checkInTime,
+	})
+
+	response := gin.H{
+		"message":       "签到成功",
+		"record_id":     recordID,
+		"check_in_time": checkInTime.Format("2006-01-02 15:04:05"),
+		"mode":          req.Mode,
+	}
+	if deviceFlagged {
+		response["device_flagged"] = true
+		response["warnings"] = []string{"该设备尚未绑定，本次签到已标记，请等待管理员审批设备"}
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *AttendanceHandler) CheckOut(c *gin.Context) {
@@ -65,11 +190,12 @@ func (h *AttendanceHandler) CheckOut(c *gin.Context) {
 
 	today := time.Now().Format("2006-01-02")
 	var recordID int
+	var checkInTime time.Time
 	var checkOutTime sql.NullTime
 	err := h.DB.QueryRow(`
-		SELECT id, check_out_time FROM attendance_records 
+		SELECT id, check_in_time, check_out_time FROM attendance_records 
 		WHERE user_id = $1 AND DATE(check_in_time) = $2
-	`, userID, today).Scan(&recordID, &checkOutTime)
+	`, userID, today).Scan(&recordID, &checkInTime, &checkOutTime)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "今日未签到"})
@@ -81,17 +207,28 @@ func (h *AttendanceHandler) CheckOut(c *gin.Context) {
 		return
 	}
 
+	// 签退记录在签到当天的考勤中，按签到日期检查锁定
+	if !checkPayrollUnlocked(c, h.DB, checkInTime, checkInTime) {
+		return
+	}
+	if !checkTimesheetUnlocked(c, h.DB, userID, checkInTime) {
+		return
+	}
+
 	checkOutTimeNow := time.Now()
 	_, err = h.DB.Exec(`
 		UPDATE attendance_records 
-		SET check_out_time = $1, check_out_location = $2
-		WHERE id = $3
-	`, checkOutTimeNow, req.Location, recordID)
+		SET check_out_time = $1, check_out_location = $2, check_out_ip = $3, check_out_device = $4
+		WHERE id = $5
+	`, checkOutTimeNow, req.Location, c.ClientIP(), deviceOf(c), recordID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "签退失败"})
 		return
 	}
+	publishPresence(h.DB, h.Presence, presence.Event{
+		Type: presence.EventCheckOut, UserID: userID.(int), Status: "out", Time: checkOutTimeNow,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":        "签退成功",
@@ -106,7 +243,7 @@ func (h *AttendanceHandler) GetMyAttendance(c *gin.Context) {
 
 	rows, err := h.DB.Query(`
 		SELECT id, user_id, check_in_time, check_out_time, 
-			   check_in_location, check_out_location, status, created_at
+			   check_in_location, check_out_location, status, project_id, mode, created_at
 		FROM attendance_records 
 		WHERE user_id = $1 AND DATE(check_in_time) BETWEEN $2 AND $3
 		ORDER BY check_in_time DESC
@@ -123,9 +260,10 @@ func (h *AttendanceHandler) GetMyAttendance(c *gin.Context) {
 		var record models.AttendanceRecord
 		var checkOutTime sql.NullTime
 		var checkInLoc, checkOutLoc, status sql.NullString
+		var projectID sql.NullInt64
 		err := rows.Scan(
 			&record.ID, &record.UserID, &record.CheckInTime, &checkOutTime,
-			&checkInLoc, &checkOutLoc, &status, &record.CreatedAt,
+			&checkInLoc, &checkOutLoc, &status, &projectID, &record.Mode, &record.CreatedAt,
 		)
 		if err != nil {
 			continue
@@ -133,6 +271,10 @@ func (h *AttendanceHandler) GetMyAttendance(c *gin.Context) {
 		if checkOutTime.Valid {
 			record.CheckOutTime = &checkOutTime.Time
 		}
+		if projectID.Valid {
+			id := int(projectID.Int64)
+			record.ProjectID = &id
+		}
 		record.CheckInLocation = checkInLoc.String
 		record.CheckOutLocation = checkOutLoc.String
 		record.Status = status.String
@@ -149,14 +291,15 @@ func (h *AttendanceHandler) GetTodayStatus(c *gin.Context) {
 	var record models.AttendanceRecord
 	var checkOutTime sql.NullTime
 	var checkInLoc, checkOutLoc, status sql.NullString
+	var projectID sql.NullInt64
 	err := h.DB.QueryRow(`
 		SELECT id, user_id, check_in_time, check_out_time, 
-			   check_in_location, check_out_location, status, created_at
+			   check_in_location, check_out_location, status, project_id, mode, created_at
 		FROM attendance_records 
 		WHERE user_id = $1 AND DATE(check_in_time) = $2
 	`, userID, today).Scan(
 		&record.ID, &record.UserID, &record.CheckInTime, &checkOutTime,
-		&checkInLoc, &checkOutLoc, &status, &record.CreatedAt,
+		&checkInLoc, &checkOutLoc, &status, &projectID, &record.Mode, &record.CreatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -178,6 +321,10 @@ func (h *AttendanceHandler) GetTodayStatus(c *gin.Context) {
 	record.CheckInLocation = checkInLoc.String
 	record.CheckOutLocation = checkOutLoc.String
 	record.Status = status.String
+	if projectID.Valid {
+		id := int(projectID.Int64)
+		record.ProjectID = &id
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"checked_in":  true,
@@ -186,21 +333,30 @@ func (h *AttendanceHandler) GetTodayStatus(c *gin.Context) {
 	})
 }
 
-func (h *AttendanceHandler) GetAllAttendance(c *gin.Context) {
-	startDate := c.DefaultQuery("start_date", time.Now().AddDate(0, -1, 0).Format("2006-01-02"))
-	endDate := c.DefaultQuery("end_date", time.Now().Format("2006-01-02"))
-
-	rows, err := h.DB.Query(`
+// queryAllAttendance 查询期间内所有员工的考勤记录，可按部门（含下级部门）筛选，列表接口和导出共用
+func queryAllAttendance(db *sql.DB, startDate, endDate string, departmentID int) (*sql.Rows, error) {
+	return db.Query(`
 		SELECT a.id, a.user_id, u.name, u.department, 
 			   a.check_in_time, a.check_out_time, 
 			   a.check_in_location, a.check_out_location, 
-			   a.status, a.created_at
+			   a.status, a.created_at, a.device_flagged, a.mode,
+			   (SELECT COUNT(*) FROM field_visits v WHERE v.attendance_record_id = a.id)
 		FROM attendance_records a
 		JOIN users u ON a.user_id = u.id
-		WHERE DATE(a.check_in_time) BETWEEN $1 AND $2
+		WHERE DATE(a.check_in_time) BETWEEN $1 AND $2 AND `+inDepartmentTree("$3")+`
 		ORDER BY a.check_in_time DESC
-	`, startDate, endDate)
+	`, startDate, endDate, departmentID)
+}
 
+func (h *AttendanceHandler) GetAllAttendance(c *gin.Context) {
+	startDate := c.DefaultQuery("start_date", time.Now().AddDate(0, -1, 0).Format("2006-01-02"))
+	endDate := c.DefaultQuery("end_date", time.Now().Format("2006-01-02"))
+	departmentID, ok := departmentIDParam(c)
+	if !ok {
+		return
+	}
+
+	rows, err := queryAllAttendance(h.DB, startDate, endDate, departmentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取考勤记录失败"})
 		return
@@ -221,7 +377,8 @@ func (h *AttendanceHandler) GetAllAttendance(c *gin.Context) {
 		err := rows.Scan(
 			&record.ID, &record.UserID, &record.UserName, &dept,
 			&record.CheckInTime, &checkOutTime,
-			&checkInLoc, &checkOutLoc, &status, &record.CreatedAt,
+			&checkInLoc, &checkOutLoc, &status, &record.CreatedAt, &record.DeviceFlagged,
+			&record.Mode, &record.FieldVisits,
 		)
 		if err != nil {
 			continue
@@ -238,3 +395,41 @@ func (h *AttendanceHandler) GetAllAttendance(c *gin.Context) {
 
 	c.JSON(http.StatusOK, records)
 }
+
+// RequestCorrection 管理员要求员工核对并更正某条考勤记录，通过通知告知本人
+func (h *AttendanceHandler) RequestCorrection(c *gin.Context) {
+	id := c.Param("id")
+	requesterID, _ := c.Get("user_id")
+	var req CorrectionRequest
+	c.ShouldBindJSON(&req)
+
+	var userID int
+	var checkInTime time.Time
+	err := h.DB.QueryRow(`
+		SELECT user_id, check_in_time FROM attendance_records WHERE id = $1
+	`, id).Scan(&userID, &checkInTime)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "考勤记录不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取考勤记录失败"})
+		return
+	}
+
+	var requesterName string
+	h.DB.QueryRow("SELECT name FROM users WHERE id = $1", requesterID).Scan(&requesterName)
+
+	h.Notifier.Notify([]int{userID}, notify.Message{
+		Event: notify.EventCorrectionRequested,
+		Ref:   fmt.Sprintf("attendance:%s", id),
+		Link:  "/dashboard/attendance",
+		Data: map[string]string{
+			"date":      checkInTime.Format("2006-01-02"),
+			"requester": requesterName,
+			"reason":    req.Reason,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "已通知员工核对考勤记录"})
+}
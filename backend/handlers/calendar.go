@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type CalendarHandler struct {
+	DB *sql.DB
+}
+
+// 团队日历单次查询的最大天数
+const maxCalendarDays = 62
+
+type CalendarLeave struct {
+	RequestID int        `json:"request_id"`
+	UserID    int        `json:"user_id"`
+	UserName  string     `json:"user_name"`
+	Status    string     `json:"status"`
+	LeaveType string     `json:"leave_type,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+}
+
+type CalendarMember struct {
+	UserID   int    `json:"user_id"`
+	UserName string `json:"user_name"`
+}
+
+type CalendarDay struct {
+	Date    string           `json:"date"`
+	Workday bool             `json:"workday"`
+	Holiday string           `json:"holiday,omitempty"`
+	OnLeave []CalendarLeave  `json:"on_leave"`
+	Absent  []CalendarMember `json:"absent"`
+}
+
+// GetTeamCalendar 按天返回部门成员的请假、缺勤以及节假日。
+// 管理员和HR可按 department_id 查看任意部门；其他人只能查看本部门，均包含下级部门，
+// 其中普通员工看不到请假原因和病假类型。
+func (h *CalendarHandler) GetTeamCalendar(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from, err1 := time.Parse("2006-01-02", c.DefaultQuery("from", monthStart.Format("2006-01-02")))
+	to, err2 := time.Parse("2006-01-02", c.DefaultQuery("to", monthStart.AddDate(0, 1, -1).Format("2006-01-02")))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式错误"})
+		return
+	}
+	if to.Before(from) || to.Sub(from).Hours()/24 >= maxCalendarDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "查询期间无效，最多查询62天"})
+		return
+	}
+
+	departmentID, ok := departmentIDParam(c)
+	if !ok {
+		return
+	}
+	var ownDepartmentID sql.NullInt64
+	if err := h.DB.QueryRow("SELECT department_id FROM users WHERE id = $1", userID).Scan(&ownDepartmentID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
+		return
+	}
+
+	fullAccess := role == "admin" || role == "hr"
+	if departmentID == 0 {
+		departmentID = int(ownDepartmentID.Int64)
+	}
+	if !fullAccess && (!ownDepartmentID.Valid || departmentID != int(ownDepartmentID.Int64)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能查看本部门的日历"})
+		return
+	}
+	showDetails := fullAccess || role == "manager"
+
+	members, err := h.departmentMembers(departmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取部门成员失败"})
+		return
+	}
+	memberIDs := make([]int, len(members))
+	for i, m := range members {
+		memberIDs[i] = m.UserID
+	}
+
+	holidays, err := holidaysInRange(h.DB, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取节假日失败"})
+		return
+	}
+
+	leavesByDay, err := h.leavesByDay(memberIDs, from, to, showDetails)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假记录失败"})
+		return
+	}
+
+	attended, err := h.attendanceByDay(memberIDs, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取考勤记录失败"})
+		return
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	days := []CalendarDay{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		key := d.Format("2006-01-02")
+		day := CalendarDay{
+			Date:    key,
+			Holiday: holidays[key],
+			OnLeave: leavesByDay[key],
+			Absent:  []CalendarMember{},
+		}
+		day.Workday = isWorkday(d) && day.Holiday == ""
+		if day.OnLeave == nil {
+			day.OnLeave = []CalendarLeave{}
+		}
+
+		// 缺勤：已过去的工作日既没有考勤记录也没有已批准的请假
+		if day.Workday && d.Before(today) {
+			onApprovedLeave := map[int]bool{}
+			for _, l := range day.OnLeave {
+				if l.Status == "approved" || l.Status == "cancel_pending" {
+					onApprovedLeave[l.UserID] = true
+				}
+			}
+			for _, m := range members {
+				if !attended[key][m.UserID] && !onApprovedLeave[m.UserID] {
+					day.Absent = append(day.Absent, m)
+				}
+			}
+		}
+		days = append(days, day)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"department_id": departmentID,
+		"from":          from.Format("2006-01-02"),
+		"to":            to.Format("2006-01-02"),
+		"members":       members,
+		"days":          days,
+	})
+}
+
+func (h *CalendarHandler) departmentMembers(departmentID int) ([]CalendarMember, error) {
+	rows, err := h.DB.Query(`
+		SELECT u.id, u.name FROM users u WHERE `+inDepartmentTree("$1")+` ORDER BY u.name
+	`, departmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []CalendarMember{}
+	for rows.Next() {
+		var m CalendarMember
+		if err := rows.Scan(&m.UserID, &m.UserName); err != nil {
+			continue
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (h *CalendarHandler) leavesByDay(userIDs []int, from, to time.Time, showDetails bool) (map[string][]CalendarLeave, error) {
+	rows, err := h.DB.Query(`
+		SELECT l.id, l.user_id, u.name, l.status, l.leave_type, l.reason,
+			   l.start_date, l.end_date, l.start_time, l.end_time
+		FROM leave_requests l
+		JOIN users u ON u.id = l.user_id
+		WHERE l.user_id = ANY($1) AND l.status IN ('pending', 'approved', 'cancel_pending')
+		  AND l.start_date <= $3 AND l.end_date >= $2
+	`, pq.Array(userIDs), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	leaves := map[string][]CalendarLeave{}
+	for rows.Next() {
+		var l CalendarLeave
+		var reason sql.NullString
+		var startDate, endDate time.Time
+		var startTime, endTime sql.NullTime
+		err := rows.Scan(
+			&l.RequestID, &l.UserID, &l.UserName, &l.Status, &l.LeaveType, &reason,
+			&startDate, &endDate, &startTime, &endTime,
+		)
+		if err != nil {
+			continue
+		}
+		if showDetails {
+			l.Reason = reason.String
+		} else if l.LeaveType == "sick" {
+			l.LeaveType = ""
+		}
+		if startTime.Valid && endTime.Valid {
+			l.StartTime = &startTime.Time
+			l.EndTime = &endTime.Time
+		}
+
+		for d := startDate; !d.After(endDate); d = d.AddDate(0, 0, 1) {
+			if d.Before(from) || d.After(to) {
+				continue
+			}
+			key := d.Format("2006-01-02")
+			leaves[key] = append(leaves[key], l)
+		}
+	}
+	return leaves, rows.Err()
+}
+
+func (h *CalendarHandler) attendanceByDay(userIDs []int, from, to time.Time) (map[string]map[int]bool, error) {
+	rows, err := h.DB.Query(`
+		SELECT DISTINCT user_id, DATE(check_in_time)
+		FROM attendance_records
+		WHERE user_id = ANY($1) AND DATE(check_in_time) BETWEEN $2 AND $3
+	`, pq.Array(userIDs), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attended := map[string]map[int]bool{}
+	for rows.Next() {
+		var userID int
+		var date time.Time
+		if err := rows.Scan(&userID, &date); err != nil {
+			continue
+		}
+		key := date.Format("2006-01-02")
+		if attended[key] == nil {
+			attended[key] = map[int]bool{}
+		}
+		attended[key][userID] = true
+	}
+	return attended, rows.Err()
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CalendarFeedHandler struct {
+	DB *sql.DB
+}
+
+// 可订阅的日历类型：我的请假、本部门请假、公司节假日
+var calendarFeedTypes = map[string]string{
+	"my":       "我的请假",
+	"team":     "团队请假",
+	"holidays": "公司节假日",
+}
+
+// 订阅源包含的历史范围，避免日历客户端每次拉取全部数据
+const calendarFeedHistoryDays = 365
+
+type icsEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	StartDate   time.Time
+	EndDate     time.Time
+	StartTime   *time.Time
+	EndTime     *time.Time
+}
+
+// feedURL 根据当前请求的地址拼出订阅链接
+func feedURL(c *gin.Context, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s/api/ics/%s.ics", scheme, c.Request.Host, token)
+}
+
+func (h *CalendarFeedHandler) GetMyFeeds(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	rows, err := h.DB.Query(`
+		SELECT feed_type, token, created_at FROM calendar_feed_tokens
+		WHERE user_id = $1 ORDER BY feed_type
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订阅链接失败"})
+		return
+	}
+	defer rows.Close()
+
+	feeds := []models.CalendarFeed{}
+	for rows.Next() {
+		var feed models.CalendarFeed
+		var token string
+		if err := rows.Scan(&feed.FeedType, &token, &feed.CreatedAt); err != nil {
+			continue
+		}
+		feed.URL = feedURL(c, token)
+		feeds = append(feeds, feed)
+	}
+
+	c.JSON(http.StatusOK, feeds)
+}
+
+// RegenerateFeedToken 生成（或重新生成）订阅令牌，旧链接随即失效
+func (h *CalendarFeedHandler) RegenerateFeedToken(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	feedType := c.Param("type")
+	if _, ok := calendarFeedTypes[feedType]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订阅类型"})
+		return
+	}
+
+	token, err := randomHex(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成订阅链接失败"})
+		return
+	}
+
+	var feed models.CalendarFeed
+	err = h.DB.QueryRow(`
+		INSERT INTO calendar_feed_tokens (user_id, feed_type, token)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, feed_type) DO UPDATE
+		SET token = EXCLUDED.token, created_at = CURRENT_TIMESTAMP
+		RETURNING feed_type, created_at
+	`, userID, feedType, token).Scan(&feed.FeedType, &feed.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成订阅链接失败"})
+		return
+	}
+	feed.URL = feedURL(c, token)
+
+	c.JSON(http.StatusOK, feed)
+}
+
+func (h *CalendarFeedHandler) RevokeFeedToken(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	result, err := h.DB.Exec(`
+		DELETE FROM calendar_feed_tokens WHERE user_id = $1 AND feed_type = $2
+	`, userID, c.Param("type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销订阅链接失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订阅链接不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "订阅链接已撤销"})
+}
+
+// ServeFeed 输出 iCalendar 订阅内容。日历客户端无法携带JWT，使用链接中的令牌鉴权
+func (h *CalendarFeedHandler) ServeFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	var userID int
+	var feedType, role string
+	var departmentID sql.NullInt64
+	err := h.DB.QueryRow(`
+		SELECT f.user_id, f.feed_type, u.role, u.department_id
+		FROM calendar_feed_tokens f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.token = $1
+	`, token).Scan(&userID, &feedType, &role, &departmentID)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "feed not found")
+		return
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "server error")
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -calendarFeedHistoryDays)
+	var events []icsEvent
+	switch feedType {
+	case "my":
+		events, err = h.leaveEvents("l.user_id = $2", since, userID, true)
+	case "team":
+		// 未分配部门的用户没有团队日历
+		if !departmentID.Valid {
+			events = []icsEvent{}
+			break
+		}
+		showDetails := role == "admin" || role == "hr" || role == "manager"
+		events, err = h.leaveEvents(inDepartmentTree("$2"), since, departmentID.Int64, showDetails)
+	case "holidays":
+		events, err = h.holidayEvents(since)
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "server error")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%s.ics", feedType))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(renderICS(calendarFeedTypes[feedType], events)))
+}
+
+func (h *CalendarFeedHandler) leaveEvents(condition string, since time.Time, arg interface{}, showDetails bool) ([]icsEvent, error) {
+	rows, err := h.DB.Query(`
+		SELECT l.id, u.name, l.leave_type, l.reason, l.start_date, l.end_date, l.start_time, l.end_time
+		FROM leave_requests l
+		JOIN users u ON u.id = l.user_id
+		WHERE l.status IN ('approved', 'cancel_pending') AND l.end_date >= $1 AND `+condition+`
+		ORDER BY l.start_date
+	`, since, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []icsEvent{}
+	for rows.Next() {
+		var id int
+		var name, leaveType string
+		var reason sql.NullString
+		var startTime, endTime sql.NullTime
+		var event icsEvent
+		err := rows.Scan(&id, &name, &leaveType, &reason, &event.StartDate, &event.EndDate, &startTime, &endTime)
+		if err != nil {
+			continue
+		}
+
+		typeName := displayName(models.LeaveTypeNames["zh"], leaveType)
+		if !showDetails && leaveType == "sick" {
+			typeName = "请假"
+		}
+		event.UID = fmt.Sprintf("leave-%d@greentech-attendance", id)
+		event.Summary = fmt.Sprintf("%s - %s", name, typeName)
+		if showDetails {
+			event.Description = reason.String
+		}
+		if startTime.Valid && endTime.Valid {
+			event.StartTime = &startTime.Time
+			event.EndTime = &endTime.Time
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (h *CalendarFeedHandler) holidayEvents(since time.Time) ([]icsEvent, error) {
+	rows, err := h.DB.Query(`
+		SELECT date, name FROM holidays WHERE date >= $1 ORDER BY date
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []icsEvent{}
+	for rows.Next() {
+		var event icsEvent
+		if err := rows.Scan(&event.StartDate, &event.Summary); err != nil {
+			continue
+		}
+		event.EndDate = event.StartDate
+		event.UID = fmt.Sprintf("holiday-%s@greentech-attendance", event.StartDate.Format("20060102"))
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// renderICS 按 RFC 5545 生成日历内容：CRLF换行，长行折叠，全天事件的结束日期不包含在内
+func renderICS(name string, events []icsEvent) string {
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(foldICSLine(s))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//GreenTech//Attendance//CN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeICSText(name))
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, e := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line("DTSTAMP:" + stamp)
+		if e.StartTime != nil && e.EndTime != nil {
+			line("DTSTART:" + e.StartTime.Format("20060102T150405"))
+			line("DTEND:" + e.EndTime.Format("20060102T150405"))
+		} else {
+			line("DTSTART;VALUE=DATE:" + e.StartDate.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + e.EndDate.AddDate(0, 0, 1).Format("20060102"))
+		}
+		line("SUMMARY:" + escapeICSText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + escapeICSText(e.Description))
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldICSLine 将超过75字节的行折叠，不拆开多字节字符
+func foldICSLine(s string) string {
+	if len(s) <= 75 {
+		return s
+	}
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
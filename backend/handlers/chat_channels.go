@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"time"
+
+	"greentech-attendance/chatbot"
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type ChatChannelHandler struct {
+	DB  *sql.DB
+	Bot *chatbot.Service
+}
+
+type ChatChannelRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	DepartmentID  int      `json:"department_id" binding:"required"`
+	Provider      string   `json:"provider" binding:"required"`
+	WebhookURL    string   `json:"webhook_url" binding:"required"`
+	Secret        *string  `json:"secret"`
+	Events        []string `json:"events" binding:"required,min=1"`
+	DigestTime    string   `json:"digest_time"`
+	Active        *bool    `json:"active"`
+	ApproversOnly bool     `json:"approvers_only"`
+}
+
+func validChatChannel(req *ChatChannelRequest) bool {
+	if !chatbot.ValidProvider(req.Provider) {
+		return false
+	}
+	u, err := url.Parse(req.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	known := map[string]bool{}
+	for _, event := range chatbot.Events {
+		known[event] = true
+	}
+	for _, event := range req.Events {
+		if !known[event] {
+			return false
+		}
+	}
+	if req.DigestTime == "" {
+		req.DigestTime = "18:00"
+	}
+	_, err = time.Parse("15:04", req.DigestTime)
+	return err == nil
+}
+
+func (h *ChatChannelHandler) GetChatChannels(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT id, name, department_id, department, provider, webhook_url, COALESCE(secret, '') <> '',
+			   approvers_only, events, digest_time, active, created_at, updated_at
+		FROM chat_channels
+		ORDER BY department, id
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取群机器人失败"})
+		return
+	}
+	defer rows.Close()
+
+	channels := []models.ChatChannel{}
+	for rows.Next() {
+		var ch models.ChatChannel
+		var departmentID sql.NullInt64
+		err := rows.Scan(
+			&ch.ID, &ch.Name, &departmentID, &ch.Department, &ch.Provider, &ch.WebhookURL, &ch.HasSecret,
+			&ch.ApproversOnly, pq.Array(&ch.Events), &ch.DigestTime, &ch.Active, &ch.CreatedAt, &ch.UpdatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		if departmentID.Valid {
+			id := int(departmentID.Int64)
+			ch.DepartmentID = &id
+		}
+		channels = append(channels, ch)
+	}
+
+	c.JSON(http.StatusOK, channels)
+}
+
+func (h *ChatChannelHandler) CreateChatChannel(c *gin.Context) {
+	var req ChatChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validChatChannel(&req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	active := req.Active == nil || *req.Active
+	department, ok := h.departmentName(c, req.DepartmentID)
+	if !ok {
+		return
+	}
+
+	var id int
+	err := h.DB.QueryRow(`
+		INSERT INTO chat_channels (name, department_id, department, provider, webhook_url, secret, events, digest_time, active, approvers_only)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, req.Name, req.DepartmentID, department, req.Provider, req.WebhookURL, req.Secret,
+		pq.Array(req.Events), req.DigestTime, active, req.ApproversOnly).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建群机器人失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "群机器人创建成功", "id": id})
+}
+
+// UpdateChatChannel 更新群机器人配置，secret 为空时保留原密钥
+func (h *ChatChannelHandler) UpdateChatChannel(c *gin.Context) {
+	var req ChatChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validChatChannel(&req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	active := req.Active == nil || *req.Active
+	department, ok := h.departmentName(c, req.DepartmentID)
+	if !ok {
+		return
+	}
+
+	result, err := h.DB.Exec(`
+		UPDATE chat_channels
+		SET name = $1, department_id = $2, department = $3, provider = $4, webhook_url = $5,
+			secret = COALESCE($6, secret), events = $7, digest_time = $8, active = $9, approvers_only = $10,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $11
+	`, req.Name, req.DepartmentID, department, req.Provider, req.WebhookURL, req.Secret,
+		pq.Array(req.Events), req.DigestTime, active, req.ApproversOnly, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新群机器人失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "群机器人不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "群机器人更新成功"})
+}
+
+// departmentName 读取群所属部门的名称，部门不存在时已返回错误响应
+func (h *ChatChannelHandler) departmentName(c *gin.Context, departmentID int) (string, bool) {
+	var name string
+	err := h.DB.QueryRow("SELECT name FROM departments WHERE id = $1", departmentID).Scan(&name)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部门不存在"})
+		return "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取部门失败"})
+		return "", false
+	}
+	return name, true
+}
+
+func (h *ChatChannelHandler) DeleteChatChannel(c *gin.Context) {
+	result, err := h.DB.Exec("DELETE FROM chat_channels WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除群机器人失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "群机器人不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// TestChatChannel 立即向群发送一份当天的考勤日报，用于验证配置
+func (h *ChatChannelHandler) TestChatChannel(c *gin.Context) {
+	channel, err := h.Bot.LoadChannel(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "群机器人不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取群机器人失败"})
+		return
+	}
+
+	if err := h.Bot.SendDigest(channel, time.Now()); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "发送失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "发送成功"})
+}
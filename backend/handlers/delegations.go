@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DelegationHandler struct {
+	DB *sql.DB
+}
+
+type CreateDelegationRequest struct {
+	DelegateID int    `json:"delegate_id" binding:"required"`
+	StartDate  string `json:"start_date" binding:"required"`
+	EndDate    string `json:"end_date" binding:"required"`
+	Reason     string `json:"reason"`
+}
+
+// CreateDelegation 设置审批委托，委托期间内路由给本人的审批由受委托人处理
+func (h *DelegationHandler) CreateDelegation(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req CreateDelegationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	startDate, err1 := time.Parse("2006-01-02", req.StartDate)
+	endDate, err2 := time.Parse("2006-01-02", req.EndDate)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式错误"})
+		return
+	}
+	if endDate.Before(startDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结束日期不能早于开始日期"})
+		return
+	}
+	if req.DelegateID == userID.(int) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能委托给自己"})
+		return
+	}
+
+	var delegateName string
+	err := h.DB.QueryRow("SELECT name FROM users WHERE id = $1", req.DelegateID).Scan(&delegateName)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "受委托人不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询用户失败"})
+		return
+	}
+
+	var delegationID int
+	err = h.DB.QueryRow(`
+		INSERT INTO approval_delegations (delegator_id, delegate_id, start_date, end_date, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, userID, req.DelegateID, startDate, endDate, req.Reason).Scan(&delegationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建审批委托失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":       "审批委托已设置",
+		"id":            delegationID,
+		"delegate_name": delegateName,
+	})
+}
+
+// GetMyDelegations 获取本人发出和收到的审批委托
+func (h *DelegationHandler) GetMyDelegations(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	rows, err := h.DB.Query(`
+		SELECT d.id, d.delegator_id, a.name, d.delegate_id, b.name,
+			   d.start_date, d.end_date, d.reason,
+			   CURRENT_DATE BETWEEN d.start_date AND d.end_date, d.created_at
+		FROM approval_delegations d
+		JOIN users a ON a.id = d.delegator_id
+		JOIN users b ON b.id = d.delegate_id
+		WHERE d.delegator_id = $1 OR d.delegate_id = $1
+		ORDER BY d.start_date DESC
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审批委托失败"})
+		return
+	}
+	defer rows.Close()
+
+	delegations := []models.ApprovalDelegation{}
+	for rows.Next() {
+		var d models.ApprovalDelegation
+		var reason sql.NullString
+		err := rows.Scan(
+			&d.ID, &d.DelegatorID, &d.DelegatorName, &d.DelegateID, &d.DelegateName,
+			&d.StartDate, &d.EndDate, &reason, &d.Active, &d.CreatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		d.Reason = reason.String
+		delegations = append(delegations, d)
+	}
+
+	c.JSON(http.StatusOK, delegations)
+}
+
+// DeleteDelegation 撤销审批委托，仅委托人或管理员可操作
+func (h *DelegationHandler) DeleteDelegation(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	var delegatorID int
+	err := h.DB.QueryRow("SELECT delegator_id FROM approval_delegations WHERE id = $1", id).Scan(&delegatorID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "审批委托不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询审批委托失败"})
+		return
+	}
+
+	if role != "admin" && delegatorID != userID.(int) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作"})
+		return
+	}
+
+	if _, err := h.DB.Exec("DELETE FROM approval_delegations WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销审批委托失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "审批委托已撤销"})
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"greentech-attendance/database"
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// DepartmentHandler 管理部门树。users.department 和 chat_channels.department 保留为所属部门名称的副本，
+// 部门改名时同步更新，按部门筛选统一使用 department_id 并包含下级部门
+type DepartmentHandler struct {
+	DB *sql.DB
+}
+
+type DepartmentRequest struct {
+	Name       string `json:"name" binding:"required,max=100"`
+	ParentID   *int   `json:"parent_id"`
+	HeadUserID *int   `json:"head_user_id"`
+}
+
+// inDepartmentTree 限定用户 u 属于指定部门或其下级部门，参数为 0 时不限制
+func inDepartmentTree(param string) string {
+	return "(" + param + " = 0 OR u.department_id IN (SELECT id FROM department_paths WHERE " + param + " = ANY(ancestors)))"
+}
+
+// departmentIDParam 读取 department_id 查询参数，未传时返回 0；格式错误时已返回错误响应
+func departmentIDParam(c *gin.Context) (int, bool) {
+	value := c.Query("department_id")
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部门ID格式错误"})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetDepartments 按层级顺序返回全部部门，前端根据 parent_id 组装部门树
+func (h *DepartmentHandler) GetDepartments(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT d.id, d.name, d.parent_id, d.head_user_id, COALESCE(hu.name, ''), p.path,
+			   (SELECT COUNT(*) FROM users WHERE department_id = d.id), d.created_at, d.updated_at
+		FROM departments d
+		JOIN department_paths p ON p.id = d.id
+		LEFT JOIN users hu ON d.head_user_id = hu.id
+		ORDER BY p.path
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取部门列表失败"})
+		return
+	}
+	defer rows.Close()
+
+	departments := []models.Department{}
+	for rows.Next() {
+		var d models.Department
+		var parentID, headUserID sql.NullInt64
+		err := rows.Scan(
+			&d.ID, &d.Name, &parentID, &headUserID, &d.HeadName, pq.Array(&d.Path),
+			&d.MemberCount, &d.CreatedAt, &d.UpdatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			d.ParentID = &id
+		}
+		if headUserID.Valid {
+			id := int(headUserID.Int64)
+			d.HeadUserID = &id
+		}
+		departments = append(departments, d)
+	}
+
+	c.JSON(http.StatusOK, departments)
+}
+
+func (h *DepartmentHandler) CreateDepartment(c *gin.Context) {
+	var req DepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	name := database.NormalizeDepartmentName(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部门名称不能为空"})
+		return
+	}
+
+	var id int
+	err := h.DB.QueryRow(`
+		INSERT INTO departments (name, parent_id, head_user_id)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, name, req.ParentID, req.HeadUserID).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "同级部门名称已存在或创建失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "部门创建成功", "id": id})
+}
+
+// UpdateDepartment 修改部门名称、上级部门和负责人；改名时同步员工和群机器人配置中的部门名称
+func (h *DepartmentHandler) UpdateDepartment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部门ID格式错误"})
+		return
+	}
+	var req DepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	name := database.NormalizeDepartmentName(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部门名称不能为空"})
+		return
+	}
+
+	// 上级部门不能是本部门或其下级部门
+	if req.ParentID != nil {
+		var cyclic bool
+		err := h.DB.QueryRow(`
+			SELECT $2 = ANY(ancestors) FROM department_paths WHERE id = $1
+		`, *req.ParentID, id).Scan(&cyclic)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "上级部门不存在"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查上级部门失败"})
+			return
+		}
+		if cyclic {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "上级部门不能是本部门或其下级部门"})
+			return
+		}
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	err = tx.QueryRow("SELECT name FROM departments WHERE id = $1 FOR UPDATE", id).Scan(&oldName)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "部门不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取部门失败"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE departments
+		SET name = $1, parent_id = $2, head_user_id = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, name, req.ParentID, req.HeadUserID, id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "同级部门名称已存在或更新失败"})
+		return
+	}
+
+	if name != oldName {
+		_, err = tx.Exec("UPDATE users SET department = $1 WHERE department_id = $2", name, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "同步员工部门失败"})
+			return
+		}
+		_, err = tx.Exec("UPDATE chat_channels SET department = $1 WHERE department_id = $2", name, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "同步群机器人部门失败"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "部门更新成功"})
+}
+
+// DeleteDepartment 删除没有下级部门、员工和群机器人的部门
+func (h *DepartmentHandler) DeleteDepartment(c *gin.Context) {
+	id := c.Param("id")
+
+	var inUse bool
+	err := h.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM departments WHERE parent_id = $1)
+			OR EXISTS (SELECT 1 FROM users WHERE department_id = $1)
+			OR EXISTS (SELECT 1 FROM chat_channels WHERE department_id = $1)
+	`, id).Scan(&inUse)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除部门失败"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "部门下还有下级部门、员工或群机器人，不能删除"})
+		return
+	}
+
+	result, err := h.DB.Exec("DELETE FROM departments WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除部门失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "部门不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// resolveDepartment 确定员工所属部门：优先使用 departmentID；只传部门名称时按规范化名称匹配已有部门，
+// 同名时优先顶级部门。部门不存在时返回 sql.ErrNoRows，两者都为空时返回 nil 和空名称
+func resolveDepartment(tx *sql.Tx, departmentID *int, name string) (interface{}, string, error) {
+	if departmentID != nil {
+		var departmentName string
+		err := tx.QueryRow("SELECT name FROM departments WHERE id = $1", *departmentID).Scan(&departmentName)
+		return *departmentID, departmentName, err
+	}
+	name = database.NormalizeDepartmentName(name)
+	if name == "" {
+		return nil, "", nil
+	}
+	var id int
+	err := tx.QueryRow(`
+		SELECT id FROM departments WHERE name = $1 ORDER BY parent_id NULLS FIRST, id LIMIT 1
+	`, name).Scan(&id)
+	return id, name, err
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 设备绑定状态：pending 待审批，approved 已绑定，revoked 已撤销。
+// 员工首次从新设备签到时自动创建 pending 绑定，由管理员审批
+type DeviceHandler struct {
+	DB *sql.DB
+}
+
+type ReviewDeviceRequest struct {
+	Status string `json:"status" binding:"required,oneof=approved revoked"`
+}
+
+// deviceFingerprint 优先使用客户端上报的设备ID（请求体或 X-Device-ID 请求头），
+// 没有时退回用 User-Agent 的摘要，只能区分不同浏览器和系统版本
+func deviceFingerprint(c *gin.Context, deviceID string) string {
+	if deviceID == "" {
+		deviceID = c.GetHeader("X-Device-ID")
+	}
+	if id := []rune(strings.TrimSpace(deviceID)); len(id) > 0 {
+		if len(id) > 128 {
+			id = id[:128]
+		}
+		return string(id)
+	}
+	sum := sha256.Sum256([]byte(c.Request.UserAgent()))
+	return "ua:" + hex.EncodeToString(sum[:16])
+}
+
+// resolveDevice 登记本次使用的设备并返回其绑定状态，新设备记为 pending
+func resolveDevice(db *sql.DB, userID interface{}, fingerprint, name, userAgent string) (string, error) {
+	var status string
+	err := db.QueryRow(`
+		INSERT INTO user_devices (user_id, fingerprint, name, user_agent)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, fingerprint) DO UPDATE
+		SET last_seen_at = CURRENT_TIMESTAMP, user_agent = EXCLUDED.user_agent,
+			name = COALESCE(NULLIF(EXCLUDED.name, ''), user_devices.name)
+		RETURNING status
+	`, userID, fingerprint, name, userAgent).Scan(&status)
+	return status, err
+}
+
+const deviceColumns = `d.id, d.user_id, u.name, d.fingerprint, COALESCE(d.name, ''), COALESCE(d.user_agent, ''),
+	d.status, d.first_seen_at, d.last_seen_at, d.reviewed_by, d.reviewed_at`
+
+func (h *DeviceHandler) listDevices(c *gin.Context, where string, args ...interface{}) {
+	rows, err := h.DB.Query(`
+		SELECT `+deviceColumns+`
+		FROM user_devices d
+		JOIN users u ON d.user_id = u.id
+		WHERE `+where+`
+		ORDER BY d.last_seen_at DESC
+	`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取设备列表失败"})
+		return
+	}
+	defer rows.Close()
+
+	devices := []models.UserDevice{}
+	for rows.Next() {
+		var d models.UserDevice
+		var reviewedBy sql.NullInt64
+		var reviewedAt sql.NullTime
+		err := rows.Scan(
+			&d.ID, &d.UserID, &d.UserName, &d.Fingerprint, &d.Name, &d.UserAgent,
+			&d.Status, &d.FirstSeenAt, &d.LastSeenAt, &reviewedBy, &reviewedAt,
+		)
+		if err != nil {
+			continue
+		}
+		if reviewedBy.Valid {
+			id := int(reviewedBy.Int64)
+			d.ReviewedBy = &id
+		}
+		if reviewedAt.Valid {
+			d.ReviewedAt = &reviewedAt.Time
+		}
+		devices = append(devices, d)
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+func (h *DeviceHandler) GetMyDevices(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	h.listDevices(c, "d.user_id = $1", userID)
+}
+
+// GetDevices 管理员查看设备绑定，可按 status 和 user_id 筛选
+func (h *DeviceHandler) GetDevices(c *gin.Context) {
+	h.listDevices(c, "($1 = '' OR d.status = $1) AND ($2 = '' OR d.user_id::text = $2)",
+		c.Query("status"), c.Query("user_id"))
+}
+
+// ReviewDevice 审批或撤销设备绑定
+func (h *DeviceHandler) ReviewDevice(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req ReviewDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	result, err := h.DB.Exec(`
+		UPDATE user_devices
+		SET status = $1, reviewed_by = $2, reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, req.Status, userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设备状态失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "设备状态已更新"})
+}
+
+// DeleteDevice 删除设备绑定记录，员工下次从该设备签到时会重新登记为待审批
+func (h *DeviceHandler) DeleteDevice(c *gin.Context) {
+	result, err := h.DB.Exec("DELETE FROM user_devices WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除设备失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
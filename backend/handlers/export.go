@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"greentech-attendance/export"
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+var attendanceStatusNames = map[string]string{
+	"normal": "正常",
+}
+
+var leaveStatusNames = map[string]string{
+	"pending":        "待审批",
+	"approved":       "已批准",
+	"rejected":       "已驳回",
+	"cancelled":      "已撤销",
+	"cancel_pending": "销假待审批",
+}
+
+func displayName(names map[string]string, key string) string {
+	if name, ok := names[key]; ok {
+		return name
+	}
+	return key
+}
+
+// startExport 校验导出格式并写出下载响应头；返回 nil 表示已返回错误响应
+func startExport(c *gin.Context, filename, sheetName string) export.Writer {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "导出格式只支持 csv 或 xlsx"})
+		return nil
+	}
+
+	filename += "." + format
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, filename, url.PathEscape(filename)))
+	c.Status(http.StatusOK)
+
+	w, err := export.New(format, c.Writer, sheetName)
+	if err != nil {
+		log.Printf("start export %s failed: %v", filename, err)
+		return nil
+	}
+	return w
+}
+
+// finishExport 数据已开始输出后出错只能记录日志并中断连接
+func finishExport(w export.Writer, rows *sql.Rows, name string) {
+	if err := rows.Err(); err != nil {
+		log.Printf("export %s failed: %v", name, err)
+		return
+	}
+	if err := w.Close(); err != nil {
+		log.Printf("export %s failed: %v", name, err)
+	}
+}
+
+// ExportAllAttendance 按与 GetAllAttendance 相同的条件导出考勤记录
+func (h *AttendanceHandler) ExportAllAttendance(c *gin.Context) {
+	startDate := c.DefaultQuery("start_date", time.Now().AddDate(0, -1, 0).Format("2006-01-02"))
+	endDate := c.DefaultQuery("end_date", time.Now().Format("2006-01-02"))
+	departmentID, ok := departmentIDParam(c)
+	if !ok {
+		return
+	}
+
+	rows, err := queryAllAttendance(h.DB, startDate, endDate, departmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取考勤记录失败"})
+		return
+	}
+	defer rows.Close()
+
+	w := startExport(c, fmt.Sprintf("attendance_%s_%s", startDate, endDate), "考勤记录")
+	if w == nil {
+		return
+	}
+	w.WriteRow([]interface{}{"员工", "部门", "日期", "签到时间", "签退时间", "签到地点", "签退地点", "状态", "工作时长(小时)", "未绑定设备", "考勤方式", "外勤拜访"})
+
+	for rows.Next() {
+		var id, userID int
+		var name string
+		var checkInTime, createdAt time.Time
+		var checkOutTime sql.NullTime
+		var dept, checkInLoc, checkOutLoc, status sql.NullString
+		var deviceFlagged bool
+		var mode string
+		var fieldVisits int
+		err := rows.Scan(
+			&id, &userID, &name, &dept, &checkInTime, &checkOutTime,
+			&checkInLoc, &checkOutLoc, &status, &createdAt, &deviceFlagged,
+			&mode, &fieldVisits,
+		)
+		if err != nil {
+			continue
+		}
+
+		var checkOut, workHours, flagged interface{}
+		if deviceFlagged {
+			flagged = "是"
+		}
+		if checkOutTime.Valid {
+			checkOut = checkOutTime.Time.Format("15:04:05")
+			workHours = math.Round(checkOutTime.Time.Sub(checkInTime).Hours()*100) / 100
+		}
+		err = w.WriteRow([]interface{}{
+			name, dept.String, checkInTime.Format("2006-01-02"), checkInTime.Format("15:04:05"), checkOut,
+			checkInLoc.String, checkOutLoc.String, displayName(attendanceStatusNames, status.String), workHours, flagged,
+			displayName(attendanceModeNames, mode), fieldVisits,
+		})
+		if err != nil {
+			log.Printf("export attendance failed: %v", err)
+			return
+		}
+	}
+	finishExport(w, rows, "attendance")
+}
+
+// ExportAllLeaveRequests 按与 GetAllLeaveRequests 相同的条件导出请假申请
+func (h *LeaveHandler) ExportAllLeaveRequests(c *gin.Context) {
+	status := c.Query("status")
+	departmentID, ok := departmentIDParam(c)
+	if !ok {
+		return
+	}
+
+	rows, err := queryAllLeaveRequests(h.DB, status, departmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假记录失败"})
+		return
+	}
+	defer rows.Close()
+
+	filename := "leave_requests"
+	if status != "" {
+		filename += "_" + status
+	}
+	w := startExport(c, filename, "请假记录")
+	if w == nil {
+		return
+	}
+	w.WriteRow([]interface{}{
+		"申请编号", "员工", "部门", "请假类型", "出差目的地", "开始日期", "结束日期", "开始时间", "结束时间",
+		"天数", "小时数", "原因", "状态", "审批备注", "提交时间",
+	})
+
+	for rows.Next() {
+		var id, userID, currentStep int
+		var name, leaveType, destination, status string
+		var startDate, endDate, createdAt, updatedAt time.Time
+		var startTime, endTime sql.NullTime
+		var days float64
+		var hours, cancelDays sql.NullFloat64
+		var approverID sql.NullInt64
+		var dept, reason, remark, cancelEndDate, cancelReason, cancelRemark sql.NullString
+		err := rows.Scan(
+			&id, &userID, &name, &dept,
+			&leaveType, &destination, &startDate, &endDate, &startTime, &endTime, &days, &hours,
+			&reason, &status, &approverID, &remark,
+			&cancelEndDate, &cancelDays, &cancelReason, &cancelRemark, &currentStep,
+			&createdAt, &updatedAt,
+		)
+		if err != nil {
+			continue
+		}
+
+		var start, end, hourValue interface{}
+		if startTime.Valid && endTime.Valid {
+			start = startTime.Time.Format("15:04")
+			end = endTime.Time.Format("15:04")
+			hourValue = hours.Float64
+		}
+		err = w.WriteRow([]interface{}{
+			id, name, dept.String, displayName(models.LeaveTypeNames["zh"], leaveType), destination,
+			startDate.Format("2006-01-02"), endDate.Format("2006-01-02"), start, end,
+			days, hourValue, reason.String, displayName(leaveStatusNames, status), remark.String,
+			createdAt.Format("2006-01-02 15:04:05"),
+		})
+		if err != nil {
+			log.Printf("export leave requests failed: %v", err)
+			return
+		}
+	}
+	finishExport(w, rows, "leave requests")
+}
+
+// ExportAllLeaveBalances 按与 GetAllLeaveBalances 相同的条件导出假期余额
+func (h *LeaveHandler) ExportAllLeaveBalances(c *gin.Context) {
+	year := c.DefaultQuery("year", "")
+	departmentID, ok := departmentIDParam(c)
+	if !ok {
+		return
+	}
+
+	rows, err := queryAllLeaveBalances(h.DB, year, departmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取假期余额失败"})
+		return
+	}
+	defer rows.Close()
+
+	if year == "" {
+		year = time.Now().Format("2006")
+	}
+	w := startExport(c, "leave_balances_"+year, "假期余额")
+	if w == nil {
+		return
+	}
+	w.WriteRow([]interface{}{"员工", "部门", "职位", "年度", "年假(天)", "病假(天)", "事假(天)"})
+
+	for rows.Next() {
+		var id, userID, balanceYear int
+		var name string
+		var dept, position sql.NullString
+		var annual, sick, personal float64
+		err := rows.Scan(&id, &userID, &name, &dept, &position, &balanceYear, &annual, &sick, &personal)
+		if err != nil {
+			continue
+		}
+		err = w.WriteRow([]interface{}{name, dept.String, position.String, balanceYear, annual, sick, personal})
+		if err != nil {
+			log.Printf("export leave balances failed: %v", err)
+			return
+		}
+	}
+	finishExport(w, rows, "leave balances")
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateFieldVisitRequest struct {
+	Location string `json:"location" binding:"required"`
+	Customer string `json:"customer" binding:"max=200"`
+	Note     string `json:"note"`
+}
+
+// CreateFieldVisit 外勤签到后，在签退前每到一个客户现场记录一次位置和拜访备注
+func (h *AttendanceHandler) CreateFieldVisit(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req CreateFieldVisitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	today := time.Now().Format("2006-01-02")
+	var recordID int
+	var mode string
+	var checkInTime time.Time
+	var checkOutTime sql.NullTime
+	err := h.DB.QueryRow(`
+		SELECT id, mode, check_in_time, check_out_time FROM attendance_records
+		WHERE user_id = $1 AND DATE(check_in_time) = $2
+	`, userID, today).Scan(&recordID, &mode, &checkInTime, &checkOutTime)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "今日未签到"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取考勤记录失败"})
+		return
+	}
+	if mode != "field" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "今日不是外勤签到，不能记录外勤拜访"})
+		return
+	}
+	if checkOutTime.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "今日已签退"})
+		return
+	}
+	if !checkPayrollUnlocked(c, h.DB, checkInTime, checkInTime) || !checkTimesheetUnlocked(c, h.DB, userID, checkInTime) {
+		return
+	}
+
+	var visit models.FieldVisit
+	err = h.DB.QueryRow(`
+		INSERT INTO field_visits (attendance_record_id, user_id, location, customer, note)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, visited_at
+	`, recordID, userID, req.Location, req.Customer, req.Note).Scan(&visit.ID, &visit.VisitedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "记录外勤拜访失败"})
+		return
+	}
+	visit.AttendanceRecordID = recordID
+	visit.Location = req.Location
+	visit.Customer = req.Customer
+	visit.Note = req.Note
+
+	c.JSON(http.StatusCreated, visit)
+}
+
+// GetFieldVisits 按时间顺序返回某条考勤记录的外勤拜访，本人或管理员可查看
+func (h *AttendanceHandler) GetFieldVisits(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	var ownerID int
+	err := h.DB.QueryRow("SELECT user_id FROM attendance_records WHERE id = $1", id).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "考勤记录不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取考勤记录失败"})
+		return
+	}
+	if ownerID != userID.(int) && role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看"})
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT id, attendance_record_id, COALESCE(location, ''), COALESCE(customer, ''), COALESCE(note, ''), visited_at
+		FROM field_visits
+		WHERE attendance_record_id = $1
+		ORDER BY visited_at
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取外勤拜访失败"})
+		return
+	}
+	defer rows.Close()
+
+	visits := []models.FieldVisit{}
+	for rows.Next() {
+		var v models.FieldVisit
+		if err := rows.Scan(&v.ID, &v.AttendanceRecordID, &v.Location, &v.Customer, &v.Note, &v.VisitedAt); err != nil {
+			continue
+		}
+		visits = append(visits, v)
+	}
+
+	c.JSON(http.StatusOK, visits)
+}
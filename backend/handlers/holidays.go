@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HolidayHandler struct {
+	DB *sql.DB
+}
+
+type CreateHolidayRequest struct {
+	Date string `json:"date" binding:"required"`
+	Name string `json:"name" binding:"required"`
+}
+
+// holidaysInRange 返回期间内的节假日，键为 YYYY-MM-DD
+func holidaysInRange(db *sql.DB, from, to time.Time) (map[string]string, error) {
+	rows, err := db.Query(`
+		SELECT date, name FROM holidays WHERE date BETWEEN $1 AND $2
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holidays := map[string]string{}
+	for rows.Next() {
+		var date time.Time
+		var name string
+		if err := rows.Scan(&date, &name); err != nil {
+			continue
+		}
+		holidays[date.Format("2006-01-02")] = name
+	}
+	return holidays, rows.Err()
+}
+
+func (h *HolidayHandler) GetHolidays(c *gin.Context) {
+	year := c.DefaultQuery("year", time.Now().Format("2006"))
+
+	rows, err := h.DB.Query(`
+		SELECT date, name FROM holidays
+		WHERE EXTRACT(YEAR FROM date) = $1
+		ORDER BY date
+	`, year)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取节假日失败"})
+		return
+	}
+	defer rows.Close()
+
+	holidays := []models.Holiday{}
+	for rows.Next() {
+		var holiday models.Holiday
+		var date time.Time
+		if err := rows.Scan(&date, &holiday.Name); err != nil {
+			continue
+		}
+		holiday.Date = date.Format("2006-01-02")
+		holidays = append(holidays, holiday)
+	}
+
+	c.JSON(http.StatusOK, holidays)
+}
+
+func (h *HolidayHandler) CreateHoliday(c *gin.Context) {
+	var req CreateHolidayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式错误"})
+		return
+	}
+
+	_, err = h.DB.Exec(`
+		INSERT INTO holidays (date, name) VALUES ($1, $2)
+		ON CONFLICT (date) DO UPDATE SET name = EXCLUDED.name
+	`, date, req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存节假日失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "节假日保存成功"})
+}
+
+func (h *HolidayHandler) DeleteHoliday(c *gin.Context) {
+	date, err := time.Parse("2006-01-02", c.Param("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式错误"})
+		return
+	}
+
+	result, err := h.DB.Exec("DELETE FROM holidays WHERE date = $1", date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除节假日失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "节假日不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
@@ -2,30 +2,46 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
+	"math"
 	"net/http"
+	"strings"
 	"time"
 
+	"greentech-attendance/chatbot"
+	"greentech-attendance/config"
 	"greentech-attendance/models"
+	"greentech-attendance/notify"
+	"greentech-attendance/presence"
+	"greentech-attendance/webhook"
 
 	"github.com/gin-gonic/gin"
 )
 
 type LeaveHandler struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Cfg      *config.Config
+	Notifier *notify.Notifier
+	ChatBot  *chatbot.Service
+	Presence *presence.Bus
 }
 
 type CreateLeaveRequestRequest struct {
-	LeaveType string  `json:"leave_type" binding:"required,oneof=annual sick personal other"`
-	StartDate string  `json:"start_date" binding:"required"`
-	EndDate   string  `json:"end_date" binding:"required"`
-	Days      float64 `json:"days" binding:"required,gt=0"`
-	Reason    string  `json:"reason" binding:"required"`
+	LeaveType string `json:"leave_type" binding:"required,oneof=annual sick personal other business_trip"`
+	// 出差目的地，出差申请必填
+	Destination string  `json:"destination" binding:"max=200"`
+	StartDate   string  `json:"start_date" binding:"required_without=StartTime"`
+	EndDate     string  `json:"end_date" binding:"required_without=StartTime"`
+	Days        float64 `json:"days" binding:"required_without=StartTime,gte=0"`
+	// 按小时请假时填写起止时间，天数按班次工时自动折算
+	StartTime string `json:"start_time" binding:"required_with=EndTime"`
+	EndTime   string `json:"end_time" binding:"required_with=StartTime"`
+	Reason    string `json:"reason" binding:"required"`
 }
 
 type ApproveLeaveRequestRequest struct {
-	Status     string `json:"status" binding:"required,oneof=approved rejected"`
-	ApproverID int    `json:"approver_id" binding:"required"`
-	Remark     string `json:"remark"`
+	Status string `json:"status" binding:"required,oneof=approved rejected"`
+	Remark string `json:"remark"`
 }
 
 type UpdateLeaveBalanceRequest struct {
@@ -44,69 +60,168 @@ func (h *LeaveHandler) CreateLeaveRequest(c *gin.Context) {
 		return
 	}
 
+	hoursPerDay := workHoursPerDay(h.Cfg)
+	var startTime, endTime *time.Time
+	var hours interface{}
+	requestHours := req.Days * hoursPerDay
+	if req.StartTime != "" {
+		st, err1 := parseLeaveTime(req.StartTime)
+		et, err2 := parseLeaveTime(req.EndTime)
+		if err1 != nil || err2 != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "时间格式错误"})
+			return
+		}
+		if !et.After(st) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "结束时间必须晚于开始时间"})
+			return
+		}
+		holidays, err := holidaysInRange(h.DB, time.Date(st.Year(), st.Month(), st.Day(), 0, 0, 0, 0, st.Location()), et)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取节假日失败"})
+			return
+		}
+		requestHours = workingHoursBetween(h.Cfg, st, et, holidays)
+		startTime, endTime, hours = &st, &et, requestHours
+		req.StartDate = st.Format("2006-01-02")
+		req.EndDate = et.Format("2006-01-02")
+		req.Days = math.Round(requestHours/hoursPerDay*1000) / 1000
+	}
+	if req.Days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请假时长必须大于0"})
+		return
+	}
+	req.Destination = strings.TrimSpace(req.Destination)
+	if req.LeaveType == "business_trip" && req.Destination == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "出差申请需要填写目的地"})
+		return
+	}
+
+	minUnit, err := leaveMinUnitHours(h.DB, req.LeaveType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假类型规则失败"})
+		return
+	}
+	if !isMultipleOf(requestHours, minUnit) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("该请假类型最小请假单位为%g小时", minUnit)})
+		return
+	}
+
 	startDate, _ := time.Parse("2006-01-02", req.StartDate)
 	endDate, _ := time.Parse("2006-01-02", req.EndDate)
 	if endDate.Before(startDate) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "结束日期不能早于开始日期"})
 		return
 	}
+	if !checkPayrollUnlocked(c, h.DB, startDate, endDate) {
+		return
+	}
 
-	currentYear := time.Now().Year()
-	var balance models.LeaveBalance
-	err := h.DB.QueryRow(`
-		SELECT annual_leave, sick_leave, personal_leave 
-		FROM leave_balances 
-		WHERE user_id = $1 AND year = $2
-	`, userID, currentYear).Scan(&balance.AnnualLeave, &balance.SickLeave, &balance.PersonalLeave)
+	overlapID, err := findOverlappingLeave(h.DB, userID, startDate, endDate, startTime, endTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查请假冲突失败"})
+		return
+	}
+	if overlapID != 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "该期间已有请假申请",
+			"request_id": overlapID,
+		})
+		return
+	}
 
-	if err == sql.ErrNoRows {
-		_, err = h.DB.Exec(`
-			INSERT INTO leave_balances (user_id, year, annual_leave, sick_leave, personal_leave)
-			VALUES ($1, $2, 10, 10, 5)
-		`, userID, currentYear)
+	// 按请假日期所在年度拆分，逐年校验余额；出差不占用假期余额
+	charges := []models.LeaveCharge{}
+	if consumesLeaveBalance(req.LeaveType) {
+		holidays, err := holidaysInRange(h.DB, startDate, endDate)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "初始化假期余额失败"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取节假日失败"})
 			return
 		}
-		balance.AnnualLeave = 10
-		balance.SickLeave = 10
-		balance.PersonalLeave = 5
+		charges = splitLeaveByYear(h.Cfg, startDate, endDate, startTime, endTime, req.Days, holidays)
 	}
-
-	switch req.LeaveType {
-	case "annual":
-		if balance.AnnualLeave < req.Days {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "年假余额不足"})
-			return
-		}
-	case "sick":
-		if balance.SickLeave < req.Days {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "病假余额不足"})
+	for _, charge := range charges {
+		balance, err := ensureLeaveBalance(h.DB, userID, charge.Year)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "初始化假期余额失败"})
 			return
 		}
-	case "personal":
-		if balance.PersonalLeave < req.Days {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "事假余额不足"})
-			return
+
+		switch req.LeaveType {
+		case "annual":
+			if balance.AnnualLeave < charge.Days {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%d年年假余额不足", charge.Year)})
+				return
+			}
+		case "sick":
+			if balance.SickLeave < charge.Days {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%d年病假余额不足", charge.Year)})
+				return
+			}
+		case "personal":
+			if balance.PersonalLeave < charge.Days {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%d年事假余额不足", charge.Year)})
+				return
+			}
 		}
 	}
 
+	steps, err := resolveApprovalSteps(h.DB, req.LeaveType, req.Days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "匹配审批流程失败"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
 	var requestID int
-	err = h.DB.QueryRow(`
-		INSERT INTO leave_requests (user_id, leave_type, start_date, end_date, days, reason, status)
-		VALUES ($1, $2, $3, $4, $5, $6, 'pending')
+	err = tx.QueryRow(`
+		INSERT INTO leave_requests (user_id, leave_type, destination, start_date, end_date, start_time, end_time, days, hours, reason, status)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10, 'pending')
 		RETURNING id
-	`, userID, req.LeaveType, startDate, endDate, req.Days, req.Reason).Scan(&requestID)
+	`, userID, req.LeaveType, req.Destination, startDate, endDate, startTime, endTime, req.Days, hours, req.Reason).Scan(&requestID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建请假申请失败"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	if err := createApprovalSteps(tx, requestID, steps); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建审批流程失败"})
+		return
+	}
+
+	if err := createLeaveCharges(tx, requestID, charges); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建请假扣减明细失败"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+	h.notifyLeaveApprovers(requestID)
+	publishLeaveStatus(h.DB, h.Presence, requestID)
+
+	response := gin.H{
 		"message":    "请假申请已提交",
 		"request_id": requestID,
-	})
+		"days":       req.Days,
+		"charges":    charges,
+	}
+	if required, err := attachmentRequired(h.DB, req.LeaveType, req.Days); err == nil && required {
+		response["attachment_required"] = true
+	}
+	// 请假期间已有考勤记录时仅提示，不阻止提交
+	if dates, err := attendanceDatesInRange(h.DB, userID, startDate, endDate); err == nil && len(dates) > 0 {
+		response["warnings"] = []string{"请假期间以下日期已有考勤记录: " + strings.Join(dates, ", ")}
+	}
+
+	c.JSON(http.StatusCreated, response)
 }
 
 func (h *LeaveHandler) GetMyLeaveRequests(c *gin.Context) {
@@ -114,8 +229,9 @@ func (h *LeaveHandler) GetMyLeaveRequests(c *gin.Context) {
 	status := c.Query("status")
 
 	query := `
-		SELECT id, user_id, leave_type, start_date, end_date, days, 
-			   reason, status, approver_id, remark, created_at, updated_at
+		SELECT id, user_id, leave_type, COALESCE(destination, ''), start_date, end_date, start_time, end_time, days, hours,
+			   reason, status, approver_id, remark,
+			   cancel_end_date, cancel_days, cancel_reason, cancel_remark, current_step, created_at, updated_at
 		FROM leave_requests 
 		WHERE user_id = $1
 	`
@@ -138,10 +254,13 @@ func (h *LeaveHandler) GetMyLeaveRequests(c *gin.Context) {
 	for rows.Next() {
 		var req models.LeaveRequest
 		var approverID sql.NullInt64
-		var remark sql.NullString
+		var remark, cancelEndDate, cancelReason, cancelRemark sql.NullString
+		var cancelDays, hours sql.NullFloat64
+		var startTime, endTime sql.NullTime
 		err := rows.Scan(
-			&req.ID, &req.UserID, &req.LeaveType, &req.StartDate, &req.EndDate,
-			&req.Days, &req.Reason, &req.Status, &approverID, &remark,
+			&req.ID, &req.UserID, &req.LeaveType, &req.Destination, &req.StartDate, &req.EndDate,
+			&startTime, &endTime, &req.Days, &hours, &req.Reason, &req.Status, &approverID, &remark,
+			&cancelEndDate, &cancelDays, &cancelReason, &cancelRemark, &req.CurrentStep,
 			&req.CreatedAt, &req.UpdatedAt,
 		)
 		if err != nil {
@@ -152,32 +271,70 @@ func (h *LeaveHandler) GetMyLeaveRequests(c *gin.Context) {
 			req.ApproverID = &aid
 		}
 		req.Remark = remark.String
+		req.CancelEndDate = cancelEndDate.String
+		req.CancelDays = cancelDays.Float64
+		req.CancelReason = cancelReason.String
+		req.CancelRemark = cancelRemark.String
+		if startTime.Valid && endTime.Valid {
+			req.StartTime = &startTime.Time
+			req.EndTime = &endTime.Time
+		}
+		req.Hours = hours.Float64
 		requests = append(requests, req)
 	}
 
+	ids := make([]int, len(requests))
+	for i := range requests {
+		ids[i] = requests[i].ID
+	}
+	charges, err := loadLeaveCharges(h.DB, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假扣减明细失败"})
+		return
+	}
+	for i := range requests {
+		requests[i].Charges = charges[requests[i].ID]
+	}
+
 	c.JSON(http.StatusOK, requests)
 }
 
-func (h *LeaveHandler) GetAllLeaveRequests(c *gin.Context) {
-	status := c.Query("status")
-
+// queryAllLeaveRequests 查询所有请假申请，可按状态和部门（含下级部门）筛选，列表接口和导出共用
+func queryAllLeaveRequests(db *sql.DB, status string, departmentID int) (*sql.Rows, error) {
 	query := `
 		SELECT l.id, l.user_id, u.name, u.department, 
-			   l.leave_type, l.start_date, l.end_date, l.days, 
+			   l.leave_type, COALESCE(l.destination, ''), l.start_date, l.end_date, l.start_time, l.end_time, l.days, l.hours,
 			   l.reason, l.status, l.approver_id, l.remark, 
+			   l.cancel_end_date, l.cancel_days, l.cancel_reason, l.cancel_remark, l.current_step,
 			   l.created_at, l.updated_at
 		FROM leave_requests l
 		JOIN users u ON l.user_id = u.id
-	`
-	args := []interface{}{}
+		WHERE ` + inDepartmentTree("$1")
+	args := []interface{}{departmentID}
 
 	if status != "" {
-		query += " WHERE l.status = $1"
+		query += " AND l.status = $2"
 		args = append(args, status)
 	}
 	query += " ORDER BY l.created_at DESC"
 
-	rows, err := h.DB.Query(query, args...)
+	return db.Query(query, args...)
+}
+
+func (h *LeaveHandler) GetAllLeaveRequests(c *gin.Context) {
+	status := c.Query("status")
+	departmentID, ok := departmentIDParam(c)
+	if !ok {
+		return
+	}
+
+	conflicts, err := pendingCoverageConflicts(h.DB, h.Cfg.MaxDeptAbsence)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "计算部门请假冲突失败"})
+		return
+	}
+
+	rows, err := queryAllLeaveRequests(h.DB, status, departmentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假记录失败"})
 		return
@@ -186,19 +343,23 @@ func (h *LeaveHandler) GetAllLeaveRequests(c *gin.Context) {
 
 	type LeaveRequestWithUser struct {
 		models.LeaveRequest
-		UserName       string `json:"user_name"`
-		UserDepartment string `json:"user_department"`
+		UserName          string             `json:"user_name"`
+		UserDepartment    string             `json:"user_department"`
+		CoverageConflicts []CoverageConflict `json:"coverage_conflicts,omitempty"`
 	}
 
 	requests := []LeaveRequestWithUser{}
 	for rows.Next() {
 		var req LeaveRequestWithUser
 		var approverID sql.NullInt64
-		var remark, dept sql.NullString
+		var remark, dept, cancelEndDate, cancelReason, cancelRemark sql.NullString
+		var cancelDays, hours sql.NullFloat64
+		var startTime, endTime sql.NullTime
 		err := rows.Scan(
 			&req.ID, &req.UserID, &req.UserName, &dept,
-			&req.LeaveType, &req.StartDate, &req.EndDate, &req.Days,
+			&req.LeaveType, &req.Destination, &req.StartDate, &req.EndDate, &startTime, &endTime, &req.Days, &hours,
 			&req.Reason, &req.Status, &approverID, &remark,
+			&cancelEndDate, &cancelDays, &cancelReason, &cancelRemark, &req.CurrentStep,
 			&req.CreatedAt, &req.UpdatedAt,
 		)
 		if err != nil {
@@ -209,15 +370,41 @@ func (h *LeaveHandler) GetAllLeaveRequests(c *gin.Context) {
 			req.ApproverID = &aid
 		}
 		req.Remark = remark.String
+		req.CancelEndDate = cancelEndDate.String
+		req.CancelDays = cancelDays.Float64
+		req.CancelReason = cancelReason.String
+		req.CancelRemark = cancelRemark.String
+		if startTime.Valid && endTime.Valid {
+			req.StartTime = &startTime.Time
+			req.EndTime = &endTime.Time
+		}
+		req.Hours = hours.Float64
 		req.UserDepartment = dept.String
+		req.CoverageConflicts = conflicts[req.ID]
 		requests = append(requests, req)
 	}
 
+	ids := make([]int, len(requests))
+	for i := range requests {
+		ids[i] = requests[i].ID
+	}
+	charges, err := loadLeaveCharges(h.DB, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假扣减明细失败"})
+		return
+	}
+	for i := range requests {
+		requests[i].Charges = charges[requests[i].ID]
+	}
+
 	c.JSON(http.StatusOK, requests)
 }
 
+// ApproveLeaveRequest 审批当前环节；非最后一个环节批准时流转到下一环节，最后环节批准后才扣减余额
 func (h *LeaveHandler) ApproveLeaveRequest(c *gin.Context) {
 	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
 	var req ApproveLeaveRequestRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
@@ -225,22 +412,84 @@ func (h *LeaveHandler) ApproveLeaveRequest(c *gin.Context) {
 	}
 
 	var leave models.LeaveRequest
+	var startDate, endDate time.Time
+	var startTime, endTime sql.NullTime
 	err := h.DB.QueryRow(`
-		SELECT user_id, leave_type, days, status 
+		SELECT id, user_id, leave_type, start_date, end_date, start_time, end_time, days, status, current_step
 		FROM leave_requests 
 		WHERE id = $1
-	`, id).Scan(&leave.UserID, &leave.LeaveType, &leave.Days, &leave.Status)
+	`, id).Scan(
+		&leave.ID, &leave.UserID, &leave.LeaveType, &startDate, &endDate, &startTime, &endTime,
+		&leave.Days, &leave.Status, &leave.CurrentStep,
+	)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "请假申请不存在"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假申请失败"})
+		return
+	}
 
 	if leave.Status != "pending" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "该申请已被处理"})
 		return
 	}
 
+	// 任何角色都不能审批自己的申请
+	if leave.UserID == userID.(int) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能审批自己的申请"})
+		return
+	}
+
+	// 管理员可代为处理任意环节；受委托人审批时记录所代表的委托人
+	principal, err := currentStepPrincipal(h.DB, id, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查审批权限失败"})
+		return
+	}
+	if principal == 0 && role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权审批该申请"})
+		return
+	}
+	var onBehalfOf interface{}
+	if principal != 0 && principal != userID.(int) {
+		onBehalfOf = principal
+	}
+
+	if req.Status == "approved" {
+		if !checkPayrollUnlocked(c, h.DB, startDate, endDate) {
+			return
+		}
+		required, err := attachmentRequired(h.DB, leave.LeaveType, leave.Days)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查附件要求失败"})
+			return
+		}
+		var attachmentCount int
+		if required {
+			err = h.DB.QueryRow("SELECT COUNT(*) FROM leave_attachments WHERE leave_request_id = $1", id).Scan(&attachmentCount)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "检查附件要求失败"})
+				return
+			}
+		}
+		if required && attachmentCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该申请需要上传证明材料后才能批准"})
+			return
+		}
+	}
+
+	var lastStep int
+	err = h.DB.QueryRow(`
+		SELECT COALESCE(MAX(step_order), 0) FROM leave_approval_steps WHERE leave_request_id = $1
+	`, id).Scan(&lastStep)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审批流程失败"})
+		return
+	}
+
 	tx, err := h.DB.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
@@ -248,11 +497,48 @@ func (h *LeaveHandler) ApproveLeaveRequest(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
+	result, err := tx.Exec(`
+		UPDATE leave_approval_steps
+		SET status = $1, acted_by = $2, on_behalf_of = $3, acted_at = CURRENT_TIMESTAMP, remark = $4
+		WHERE leave_request_id = $5 AND step_order = $6 AND status = 'pending'
+	`, req.Status, userID, onBehalfOf, req.Remark, id, leave.CurrentStep)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新审批环节失败"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该申请已被处理"})
+		return
+	}
+
+	if req.Status == "approved" && leave.CurrentStep < lastStep {
+		_, err = tx.Exec(`
+			UPDATE leave_requests
+			SET current_step = current_step + 1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新申请状态失败"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+			return
+		}
+		h.notifyLeaveApprovers(leave.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "已批准，进入下一审批环节",
+			"current_step": leave.CurrentStep + 1,
+		})
+		return
+	}
+
 	_, err = tx.Exec(`
 		UPDATE leave_requests 
-		SET status = $1, approver_id = $2, remark = $3, updated_at = CURRENT_TIMESTAMP
+		SET status = $1, approver_id = $2, remark = $3,
+			approved_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $4
-	`, req.Status, req.ApproverID, req.Remark, id)
+	`, req.Status, userID, req.Remark, id)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新申请状态失败"})
@@ -260,23 +546,47 @@ func (h *LeaveHandler) ApproveLeaveRequest(c *gin.Context) {
 	}
 
 	if req.Status == "approved" {
-		currentYear := time.Now().Year()
-		var column string
-		switch leave.LeaveType {
-		case "annual":
-			column = "annual_leave"
-		case "sick":
-			column = "sick_leave"
-		case "personal":
-			column = "personal_leave"
-		default:
-			column = "annual_leave"
+		charges, err := getLeaveCharges(tx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假扣减明细失败"})
+			return
+		}
+		// 早期提交的申请没有扣减明细，审批时按请假日期补算
+		if len(charges) == 0 && consumesLeaveBalance(leave.LeaveType) {
+			var st, et *time.Time
+			if startTime.Valid && endTime.Valid {
+				st, et = &startTime.Time, &endTime.Time
+			}
+			holidays, err := holidaysInRange(h.DB, startDate, endDate)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "获取节假日失败"})
+				return
+			}
+			charges = splitLeaveByYear(h.Cfg, startDate, endDate, st, et, leave.Days, holidays)
+			if err := createLeaveCharges(tx, leave.ID, charges); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "创建请假扣减明细失败"})
+				return
+			}
+		}
+		for _, charge := range charges {
+			if err := adjustLeaveBalance(tx, leave.UserID, leave.LeaveType, charge.Year, -charge.Days); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "更新假期余额失败"})
+				return
+			}
 		}
 
-		query := `UPDATE leave_balances SET ` + column + ` = ` + column + ` - $1 WHERE user_id = $2 AND year = $3`
-		_, err = tx.Exec(query, leave.Days, leave.UserID, currentYear)
+		err = webhook.Enqueue(tx, webhook.EventLeaveApproved, gin.H{
+			"request_id":  leave.ID,
+			"user_id":     leave.UserID,
+			"leave_type":  leave.LeaveType,
+			"start_date":  startDate.Format("2006-01-02"),
+			"end_date":    endDate.Format("2006-01-02"),
+			"days":        leave.Days,
+			"charges":     charges,
+			"approver_id": userID,
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新假期余额失败"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "记录审批事件失败"})
 			return
 		}
 	}
@@ -285,10 +595,51 @@ func (h *LeaveHandler) ApproveLeaveRequest(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
 		return
 	}
+	h.notifyLeaveDecision(id, req.Status, userID, req.Remark)
+	publishLeaveStatus(h.DB, h.Presence, id)
 
 	c.JSON(http.StatusOK, gin.H{"message": "处理成功"})
 }
 
+// consumesLeaveBalance 出差按出勤处理，不扣减假期余额
+func consumesLeaveBalance(leaveType string) bool {
+	return leaveType != "business_trip"
+}
+
+// leaveBalanceColumn 返回请假类型对应的余额字段
+func leaveBalanceColumn(leaveType string) string {
+	switch leaveType {
+	case "annual":
+		return "annual_leave"
+	case "sick":
+		return "sick_leave"
+	case "personal":
+		return "personal_leave"
+	default:
+		return "annual_leave"
+	}
+}
+
+// adjustLeaveBalance 按天数增减指定年度的假期余额，delta为负表示扣减；该年度尚无余额记录时按默认额度创建
+func adjustLeaveBalance(tx *sql.Tx, userID int, leaveType string, year int, delta float64) error {
+	if !consumesLeaveBalance(leaveType) {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO leave_balances (user_id, year, annual_leave, sick_leave, personal_leave)
+		VALUES ($1, $2, 10, 10, 5)
+		ON CONFLICT (user_id, year) DO NOTHING
+	`, userID, year)
+	if err != nil {
+		return err
+	}
+
+	column := leaveBalanceColumn(leaveType)
+	query := `UPDATE leave_balances SET ` + column + ` = ` + column + ` + $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2 AND year = $3`
+	_, err = tx.Exec(query, delta, userID, year)
+	return err
+}
+
 func (h *LeaveHandler) GetLeaveBalance(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	currentYear := time.Now().Year()
@@ -322,31 +673,42 @@ func (h *LeaveHandler) GetLeaveBalance(c *gin.Context) {
 		return
 	}
 
+	fillBalanceHours(&balance, workHoursPerDay(h.Cfg))
 	c.JSON(http.StatusOK, balance)
 }
 
-func (h *LeaveHandler) GetAllLeaveBalances(c *gin.Context) {
+// queryAllLeaveBalances 查询某年度所有员工的假期余额，未指定年度时为当年，可按部门（含下级部门）筛选，列表接口和导出共用
+func queryAllLeaveBalances(db *sql.DB, year string, departmentID int) (*sql.Rows, error) {
 	currentYear := time.Now().Year()
-	year := c.DefaultQuery("year", "")
 
 	query := `
 		SELECT lb.id, lb.user_id, u.name, u.department, u.position,
 			   lb.year, lb.annual_leave, lb.sick_leave, lb.personal_leave
 		FROM leave_balances lb
 		JOIN users u ON lb.user_id = u.id
-	`
-	args := []interface{}{}
+		LEFT JOIN department_paths dp ON dp.id = u.department_id
+		WHERE ` + inDepartmentTree("$1")
+	args := []interface{}{departmentID}
 
 	if year != "" {
-		query += " WHERE lb.year = $1"
+		query += " AND lb.year = $2"
 		args = append(args, year)
 	} else {
-		query += " WHERE lb.year = $1"
+		query += " AND lb.year = $2"
 		args = append(args, currentYear)
 	}
-	query += " ORDER BY u.department, u.name"
+	// 按部门层级排序，下级部门紧跟在上级部门之后
+	query += " ORDER BY dp.path NULLS LAST, u.name"
 
-	rows, err := h.DB.Query(query, args...)
+	return db.Query(query, args...)
+}
+
+func (h *LeaveHandler) GetAllLeaveBalances(c *gin.Context) {
+	departmentID, ok := departmentIDParam(c)
+	if !ok {
+		return
+	}
+	rows, err := queryAllLeaveBalances(h.DB, c.DefaultQuery("year", ""), departmentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取假期余额失败"})
 		return
@@ -360,6 +722,7 @@ func (h *LeaveHandler) GetAllLeaveBalances(c *gin.Context) {
 		UserPosition   string `json:"user_position"`
 	}
 
+	hoursPerDay := workHoursPerDay(h.Cfg)
 	balances := []LeaveBalanceWithUser{}
 	for rows.Next() {
 		var balance LeaveBalanceWithUser
@@ -373,6 +736,7 @@ func (h *LeaveHandler) GetAllLeaveBalances(c *gin.Context) {
 		}
 		balance.UserDepartment = dept.String
 		balance.UserPosition = position.String
+		fillBalanceHours(&balance.LeaveBalance, hoursPerDay)
 		balances = append(balances, balance)
 	}
 
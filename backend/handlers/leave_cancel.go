@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CancelLeaveRequestRequest struct {
+	// EndDate 为空表示整体销假；否则为提前返岗后的新结束日期，实际请假天数由服务端按工作日计算
+	EndDate string `json:"end_date"`
+	Reason  string `json:"reason"`
+}
+
+// WithdrawLeaveRequest 撤回尚未审批的请假申请
+func (h *LeaveHandler) WithdrawLeaveRequest(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+
+	var ownerID int
+	var status string
+	err := h.DB.QueryRow(`
+		SELECT user_id, status FROM leave_requests WHERE id = $1
+	`, id).Scan(&ownerID, &status)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "请假申请不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假申请失败"})
+		return
+	}
+
+	if ownerID != userID.(int) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作"})
+		return
+	}
+
+	if status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能撤回待审批的申请"})
+		return
+	}
+
+	result, err := h.DB.Exec(`
+		UPDATE leave_requests
+		SET status = 'cancelled', cancelled_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'pending'
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤回申请失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该申请已被处理"})
+		return
+	}
+	publishLeaveStatus(h.DB, h.Presence, id)
+
+	c.JSON(http.StatusOK, gin.H{"message": "申请已撤回"})
+}
+
+// RequestLeaveCancellation 对已批准的请假申请发起销假，需审批人确认
+func (h *LeaveHandler) RequestLeaveCancellation(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	var req CancelLeaveRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var ownerID int
+	var startDate, endDate time.Time
+	var startTime, endTime sql.NullTime
+	var days float64
+	var status string
+	err := h.DB.QueryRow(`
+		SELECT user_id, start_date, end_date, start_time, end_time, days, status
+		FROM leave_requests
+		WHERE id = $1
+	`, id).Scan(&ownerID, &startDate, &endDate, &startTime, &endTime, &days, &status)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "请假申请不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假申请失败"})
+		return
+	}
+
+	if ownerID != userID.(int) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作"})
+		return
+	}
+
+	if status != "approved" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能对已批准的申请销假"})
+		return
+	}
+	if !checkPayrollUnlocked(c, h.DB, startDate, endDate) {
+		return
+	}
+
+	var cancelEndDate interface{}
+	cancelDays := days
+	if req.EndDate != "" {
+		newEndDate, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式错误"})
+			return
+		}
+		if newEndDate.Before(startDate) || !newEndDate.Before(endDate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "新的结束日期必须在原请假期间内"})
+			return
+		}
+
+		// 实际请假时长按申请时的口径计算：按小时请假统计工作时段内的小时数，按天请假统计工作日，均不含节假日
+		holidays, err := holidaysInRange(h.DB, startDate, newEndDate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取节假日失败"})
+			return
+		}
+		var taken float64
+		if startTime.Valid && endTime.Valid {
+			nextDay := newEndDate.AddDate(0, 0, 1)
+			until := time.Date(nextDay.Year(), nextDay.Month(), nextDay.Day(), 0, 0, 0, 0, startTime.Time.Location())
+			hours := workingHoursBetween(h.Cfg, startTime.Time, until, holidays)
+			taken = math.Round(hours/workHoursPerDay(h.Cfg)*1000) / 1000
+		} else {
+			taken = math.Min(workdaysBetween(startDate, newEndDate, holidays), days)
+		}
+		if taken <= 0 || taken >= days {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "提前返岗后的实际请假天数无效，请整体销假"})
+			return
+		}
+		cancelEndDate = newEndDate
+		cancelDays = days - taken
+	}
+
+	result, err := h.DB.Exec(`
+		UPDATE leave_requests
+		SET status = 'cancel_pending', cancel_end_date = $1, cancel_days = $2, cancel_reason = $3,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND status = 'approved'
+	`, cancelEndDate, cancelDays, req.Reason, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交销假申请失败"})
+		return
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该申请已被处理"})
+		return
+	}
+	publishLeaveStatus(h.DB, h.Presence, id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "销假申请已提交",
+		"cancel_days": cancelDays,
+	})
+}
+
+// ApproveLeaveCancellation 由原审批人或管理员审批销假申请，批准后将天数退回原扣减年度的余额
+func (h *LeaveHandler) ApproveLeaveCancellation(c *gin.Context) {
+	id := c.Param("id")
+	approverID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+	var req ApproveLeaveRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var userID int
+	var leaveType, status string
+	var days float64
+	var startDate, endDate time.Time
+	var startTime sql.NullTime
+	var originalApproverID, balanceYear sql.NullInt64
+	var cancelEndDate sql.NullTime
+	var cancelDays sql.NullFloat64
+	err := h.DB.QueryRow(`
+		SELECT user_id, leave_type, start_date, end_date, start_time, days, status, approver_id, balance_year, cancel_end_date, cancel_days
+		FROM leave_requests
+		WHERE id = $1
+	`, id).Scan(&userID, &leaveType, &startDate, &endDate, &startTime, &days, &status, &originalApproverID, &balanceYear, &cancelEndDate, &cancelDays)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "请假申请不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假申请失败"})
+		return
+	}
+
+	// 原审批人委托他人代审期间，受委托人也可处理
+	principals, err := approvalPrincipals(h.DB, approverID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查审批权限失败"})
+		return
+	}
+	allowed := role == "admin"
+	for _, principal := range principals {
+		if originalApproverID.Valid && int(originalApproverID.Int64) == principal {
+			allowed = true
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权审批该申请"})
+		return
+	}
+
+	if status != "cancel_pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该申请没有待审批的销假"})
+		return
+	}
+	if req.Status != "rejected" && !checkPayrollUnlocked(c, h.DB, startDate, endDate) {
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	if req.Status == "rejected" {
+		_, err = tx.Exec(`
+			UPDATE leave_requests
+			SET status = 'approved', cancel_end_date = NULL, cancel_days = NULL,
+				cancel_approver_id = $1, cancel_remark = $2, cancel_decided_at = CURRENT_TIMESTAMP,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = $3
+		`, approverID, req.Remark, id)
+	} else if cancelEndDate.Valid && startTime.Valid {
+		// 按小时请假提前返岗：保留开始时间，结束时间改为新结束日期的下班时间，并重新计算小时数
+		windows := shiftWindows(h.Cfg)
+		newEnd := cancelEndDate.Time
+		newEndTime := time.Date(newEnd.Year(), newEnd.Month(), newEnd.Day(), 0, 0, 0, 0, startTime.Time.Location()).
+			Add(time.Duration(windows[len(windows)-1][1]) * time.Minute)
+		var holidays map[string]string
+		holidays, err = holidaysInRange(h.DB, startDate, newEnd)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取节假日失败"})
+			return
+		}
+		hours := workingHoursBetween(h.Cfg, startTime.Time, newEndTime, holidays)
+		_, err = tx.Exec(`
+			UPDATE leave_requests
+			SET status = 'approved', end_date = cancel_end_date, days = days - $1,
+				end_time = $2, hours = $3,
+				cancel_approver_id = $4, cancel_remark = $5, cancel_decided_at = CURRENT_TIMESTAMP,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = $6
+		`, cancelDays.Float64, newEndTime, hours, approverID, req.Remark, id)
+	} else if cancelEndDate.Valid {
+		// 提前返岗：缩短请假期间，保留销假天数作为记录
+		_, err = tx.Exec(`
+			UPDATE leave_requests
+			SET status = 'approved', end_date = cancel_end_date, days = days - $1,
+				cancel_approver_id = $2, cancel_remark = $3, cancel_decided_at = CURRENT_TIMESTAMP,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = $4
+		`, cancelDays.Float64, approverID, req.Remark, id)
+	} else {
+		_, err = tx.Exec(`
+			UPDATE leave_requests
+			SET status = 'cancelled', cancelled_at = CURRENT_TIMESTAMP,
+				cancel_approver_id = $1, cancel_remark = $2, cancel_decided_at = CURRENT_TIMESTAMP,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = $3
+		`, approverID, req.Remark, id)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新申请状态失败"})
+		return
+	}
+
+	if req.Status == "approved" {
+		refund := days
+		if cancelDays.Valid {
+			refund = cancelDays.Float64
+		}
+
+		charges, err := getLeaveCharges(tx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假扣减明细失败"})
+			return
+		}
+		if len(charges) > 0 {
+			err = refundLeaveCharges(tx, id, userID, leaveType, refund)
+		} else {
+			// 早期审批的申请没有扣减明细，退回到审批时记录的年度
+			year := time.Now().Year()
+			if balanceYear.Valid {
+				year = int(balanceYear.Int64)
+			}
+			err = adjustLeaveBalance(tx, userID, leaveType, year, refund)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "退回假期余额失败"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+	publishLeaveStatus(h.DB, h.Presence, id)
+
+	c.JSON(http.StatusOK, gin.H{"message": "处理成功"})
+}
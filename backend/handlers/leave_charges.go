@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"greentech-attendance/config"
+	"greentech-attendance/models"
+
+	"github.com/lib/pq"
+)
+
+// workdaysBetween 统计 from 至 to（含两端）之间不是节假日的工作日天数
+func workdaysBetween(from, to time.Time, holidays map[string]string) float64 {
+	days := 0.0
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if isChargeableDay(d, holidays) {
+			days++
+		}
+	}
+	return days
+}
+
+// splitLeaveByYear 按请假日期所在的余额年度拆分扣减天数。
+// 跨年申请按各年度内的工作日（按小时请假时为工作小时）比例分配，节假日不计入，最后一个年度取余数。
+// holidays 需覆盖整个请假期间
+func splitLeaveByYear(cfg *config.Config, startDate, endDate time.Time, startTime, endTime *time.Time, days float64, holidays map[string]string) []models.LeaveCharge {
+	if startDate.Year() == endDate.Year() {
+		return []models.LeaveCharge{{Year: startDate.Year(), Days: days}}
+	}
+
+	years := []int{}
+	weights := []float64{}
+	calendarDays := []float64{}
+	total, calendarTotal := 0.0, 0.0
+	for year := startDate.Year(); year <= endDate.Year(); year++ {
+		yearStart := time.Date(year, 1, 1, 0, 0, 0, 0, startDate.Location())
+		yearEnd := time.Date(year, 12, 31, 0, 0, 0, 0, startDate.Location())
+		segStart, segEnd := startDate, endDate
+		if segStart.Before(yearStart) {
+			segStart = yearStart
+		}
+		if segEnd.After(yearEnd) {
+			segEnd = yearEnd
+		}
+
+		weight := 0.0
+		if startTime != nil && endTime != nil {
+			s, e := *startTime, *endTime
+			ys := time.Date(year, 1, 1, 0, 0, 0, 0, s.Location())
+			ye := ys.AddDate(1, 0, 0)
+			if s.Before(ys) {
+				s = ys
+			}
+			if e.After(ye) {
+				e = ye
+			}
+			if e.After(s) {
+				weight = workingHoursBetween(cfg, s, e, holidays)
+			}
+		} else {
+			weight = workdaysBetween(segStart, segEnd, holidays)
+		}
+		calendar := math.Floor(segEnd.Sub(segStart).Hours()/24) + 1
+
+		years = append(years, year)
+		weights = append(weights, weight)
+		calendarDays = append(calendarDays, calendar)
+		total += weight
+		calendarTotal += calendar
+	}
+	if total == 0 {
+		weights, total = calendarDays, calendarTotal
+	}
+
+	// 按天请假时分配到半天，按小时请假时保留三位小数
+	precision := 2.0
+	if startTime != nil {
+		precision = 1000
+	}
+	charges := []models.LeaveCharge{}
+	remaining := days
+	for i, year := range years {
+		share := remaining
+		if i < len(years)-1 {
+			share = math.Round(days*weights[i]/total*precision) / precision
+			if share > remaining {
+				share = remaining
+			}
+		}
+		remaining -= share
+		if share > 0 {
+			charges = append(charges, models.LeaveCharge{Year: year, Days: share})
+		}
+	}
+	return charges
+}
+
+// ensureLeaveBalance 确保用户指定年度的假期余额记录存在，不存在时按默认额度创建
+func ensureLeaveBalance(db *sql.DB, userID interface{}, year int) (models.LeaveBalance, error) {
+	var balance models.LeaveBalance
+	err := db.QueryRow(`
+		SELECT annual_leave, sick_leave, personal_leave
+		FROM leave_balances
+		WHERE user_id = $1 AND year = $2
+	`, userID, year).Scan(&balance.AnnualLeave, &balance.SickLeave, &balance.PersonalLeave)
+
+	if err == sql.ErrNoRows {
+		_, err = db.Exec(`
+			INSERT INTO leave_balances (user_id, year, annual_leave, sick_leave, personal_leave)
+			VALUES ($1, $2, 10, 10, 5)
+			ON CONFLICT (user_id, year) DO NOTHING
+		`, userID, year)
+		balance.AnnualLeave = 10
+		balance.SickLeave = 10
+		balance.PersonalLeave = 5
+	}
+	balance.Year = year
+	return balance, err
+}
+
+func createLeaveCharges(tx *sql.Tx, requestID int, charges []models.LeaveCharge) error {
+	for _, charge := range charges {
+		_, err := tx.Exec(`
+			INSERT INTO leave_request_charges (leave_request_id, year, days)
+			VALUES ($1, $2, $3)
+		`, requestID, charge.Year, charge.Days)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getLeaveCharges 获取请假申请按年度拆分的扣减明细，按年度升序
+func getLeaveCharges(tx *sql.Tx, requestID interface{}) ([]models.LeaveCharge, error) {
+	rows, err := tx.Query(`
+		SELECT year, days FROM leave_request_charges
+		WHERE leave_request_id = $1
+		ORDER BY year
+	`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	charges := []models.LeaveCharge{}
+	for rows.Next() {
+		var charge models.LeaveCharge
+		if err := rows.Scan(&charge.Year, &charge.Days); err != nil {
+			return nil, err
+		}
+		charges = append(charges, charge)
+	}
+	return charges, rows.Err()
+}
+
+// loadLeaveCharges 批量获取多个请假申请的年度扣减明细
+func loadLeaveCharges(db *sql.DB, requestIDs []int) (map[int][]models.LeaveCharge, error) {
+	charges := map[int][]models.LeaveCharge{}
+	if len(requestIDs) == 0 {
+		return charges, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT leave_request_id, year, days FROM leave_request_charges
+		WHERE leave_request_id = ANY($1)
+		ORDER BY leave_request_id, year
+	`, pq.Array(requestIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var charge models.LeaveCharge
+		if err := rows.Scan(&id, &charge.Year, &charge.Days); err != nil {
+			continue
+		}
+		charges[id] = append(charges[id], charge)
+	}
+	return charges, rows.Err()
+}
+
+// refundLeaveCharges 退回指定天数，从最晚的年度开始退（提前返岗时被取消的是期间末尾的日期），
+// 并同步减少扣减明细
+func refundLeaveCharges(tx *sql.Tx, requestID interface{}, userID int, leaveType string, days float64) error {
+	charges, err := getLeaveCharges(tx, requestID)
+	if err != nil {
+		return err
+	}
+	sort.Slice(charges, func(i, j int) bool { return charges[i].Year > charges[j].Year })
+
+	remaining := days
+	for _, charge := range charges {
+		if remaining <= 0 {
+			break
+		}
+		refund := math.Min(remaining, charge.Days)
+		if err := adjustLeaveBalance(tx, userID, leaveType, charge.Year, refund); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			UPDATE leave_request_charges SET days = days - $1
+			WHERE leave_request_id = $2 AND year = $3
+		`, refund, requestID, charge.Year)
+		if err != nil {
+			return err
+		}
+		remaining -= refund
+	}
+	return nil
+}
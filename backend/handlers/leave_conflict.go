@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"database/sql"
+	"time"
+)
+
+// CoverageConflict 表示某一天部门请假人数超出上限
+type CoverageConflict struct {
+	Date     string `json:"date"`
+	OffCount int    `json:"off_count"`
+}
+
+// findOverlappingLeave 查找与给定期间重叠的待审批或已批准的请假申请；
+// 双方都是按小时请假时按具体时间比较，否则按日期比较
+func findOverlappingLeave(db *sql.DB, userID interface{}, startDate, endDate time.Time, startTime, endTime *time.Time) (int, error) {
+	var id int
+	err := db.QueryRow(`
+		SELECT id FROM leave_requests
+		WHERE user_id = $1 AND status IN ('pending', 'approved', 'cancel_pending')
+		  AND CASE WHEN start_time IS NOT NULL AND $4::timestamp IS NOT NULL
+			  THEN start_time < $5::timestamp AND end_time > $4::timestamp
+			  ELSE start_date <= $3 AND end_date >= $2
+		  END
+		ORDER BY start_date
+		LIMIT 1
+	`, userID, startDate, endDate, startTime, endTime).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// attendanceDatesInRange 返回期间内已有考勤记录的日期
+func attendanceDatesInRange(db *sql.DB, userID interface{}, startDate, endDate time.Time) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT DATE(check_in_time) AS d FROM attendance_records
+		WHERE user_id = $1 AND DATE(check_in_time) BETWEEN $2 AND $3
+		ORDER BY d
+	`, userID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := []string{}
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			continue
+		}
+		dates = append(dates, d.Format("2006-01-02"))
+	}
+	return dates, rows.Err()
+}
+
+// pendingCoverageConflicts 计算每个待审批申请在哪些日期会使部门请假人数超过上限
+func pendingCoverageConflicts(db *sql.DB, limit int) (map[int][]CoverageConflict, error) {
+	conflicts := map[int][]CoverageConflict{}
+	if limit <= 0 {
+		return conflicts, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT l.id, d::date, COUNT(DISTINCT o.user_id)
+		FROM leave_requests l
+		JOIN users u ON u.id = l.user_id
+		CROSS JOIN LATERAL generate_series(l.start_date, l.end_date, interval '1 day') AS d
+		JOIN leave_requests o ON o.status IN ('approved', 'cancel_pending')
+			AND o.user_id <> l.user_id AND d::date BETWEEN o.start_date AND o.end_date
+		JOIN users ou ON ou.id = o.user_id AND ou.department_id = u.department_id
+		WHERE l.status = 'pending'
+		GROUP BY l.id, d
+		HAVING COUNT(DISTINCT o.user_id) + 1 > $1
+		ORDER BY l.id, d
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, othersOff int
+		var d time.Time
+		if err := rows.Scan(&id, &d, &othersOff); err != nil {
+			continue
+		}
+		conflicts[id] = append(conflicts[id], CoverageConflict{
+			Date:     d.Format("2006-01-02"),
+			OffCount: othersOff + 1,
+		})
+	}
+	return conflicts, rows.Err()
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"greentech-attendance/config"
+	"greentech-attendance/models"
+)
+
+// parseClock 将 HH:MM 解析为当天的分钟数
+func parseClock(value string, fallback int) int {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return fallback
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return fallback
+	}
+	return h*60 + m
+}
+
+// shiftWindows 返回班次中扣除午休后的工作时段（以当天分钟数表示）
+func shiftWindows(cfg *config.Config) [][2]int {
+	start := parseClock(cfg.WorkStartTime, 9*60)
+	end := parseClock(cfg.WorkEndTime, 18*60)
+	breakStart := parseClock(cfg.BreakStartTime, 12*60)
+	breakEnd := parseClock(cfg.BreakEndTime, 13*60)
+
+	if breakStart <= start || breakEnd >= end || breakEnd <= breakStart {
+		return [][2]int{{start, end}}
+	}
+	return [][2]int{{start, breakStart}, {breakEnd, end}}
+}
+
+// workHoursPerDay 返回每个工作日的标准工时
+func workHoursPerDay(cfg *config.Config) float64 {
+	minutes := 0
+	for _, w := range shiftWindows(cfg) {
+		minutes += w[1] - w[0]
+	}
+	return float64(minutes) / 60
+}
+
+// isWorkday 判断是否为工作日（周一至周五）
+func isWorkday(day time.Time) bool {
+	weekday := day.Weekday()
+	return weekday != time.Saturday && weekday != time.Sunday
+}
+
+// isChargeableDay 判断请假是否计入当天：工作日且不是节假日，holidays 的键为 YYYY-MM-DD
+func isChargeableDay(day time.Time, holidays map[string]string) bool {
+	return isWorkday(day) && holidays[day.Format("2006-01-02")] == ""
+}
+
+// workingHoursBetween 计算区间内落在班次工作时段内的小时数，跳过非工作日和节假日
+func workingHoursBetween(cfg *config.Config, start, end time.Time, holidays map[string]string) float64 {
+	windows := shiftWindows(cfg)
+	minutes := 0.0
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	for !day.After(end) {
+		if isChargeableDay(day, holidays) {
+			for _, w := range windows {
+				ws := day.Add(time.Duration(w[0]) * time.Minute)
+				we := day.Add(time.Duration(w[1]) * time.Minute)
+				if start.After(ws) {
+					ws = start
+				}
+				if end.Before(we) {
+					we = end
+				}
+				if we.After(ws) {
+					minutes += we.Sub(ws).Minutes()
+				}
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return math.Round(minutes/60*100) / 100
+}
+
+// parseLeaveTime 解析请假起止时间，支持 RFC3339 和本地时间格式
+func parseLeaveTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(time.Local), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+}
+
+// isMultipleOf 判断小时数是否为最小请假单位的整数倍
+func isMultipleOf(hours, unit float64) bool {
+	if unit <= 0 {
+		return true
+	}
+	ratio := hours / unit
+	return ratio >= 1-1e-9 && math.Abs(ratio-math.Round(ratio)) < 1e-6
+}
+
+// fillBalanceHours 按班次工时换算余额小时数
+func fillBalanceHours(balance *models.LeaveBalance, hoursPerDay float64) {
+	balance.HoursPerDay = hoursPerDay
+	balance.AnnualLeaveHours = math.Round(balance.AnnualLeave*hoursPerDay*100) / 100
+	balance.SickLeaveHours = math.Round(balance.SickLeave*hoursPerDay*100) / 100
+	balance.PersonalLeaveHours = math.Round(balance.PersonalLeave*hoursPerDay*100) / 100
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"greentech-attendance/notify"
+)
+
+// currentStepApprovers 返回能审批当前环节的用户，包括当前有效委托的受托人，但不包括申请人本人
+func currentStepApprovers(db *sql.DB, requestID interface{}) ([]int, error) {
+	rows, err := db.Query(`
+		WITH approvers AS (
+			SELECT ap.id FROM leave_requests l
+			JOIN users u ON u.id = l.user_id
+			JOIN leave_approval_steps s ON s.leave_request_id = l.id AND s.step_order = l.current_step
+			JOIN users ap ON TRUE
+			WHERE l.id = $1 AND l.status = 'pending' AND s.status = 'pending'
+			  AND `+approverMatchCondition+`
+		)
+		SELECT id FROM approvers
+		UNION
+		SELECT d.delegate_id FROM approval_delegations d
+		JOIN approvers a ON a.id = d.delegator_id
+		JOIN leave_requests l ON l.id = $1
+		WHERE CURRENT_DATE BETWEEN d.start_date AND d.end_date AND d.delegate_id <> l.user_id
+	`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// leaveNotificationData 读取请假申请用于通知模板的字段，返回申请人ID
+func leaveNotificationData(db *sql.DB, requestID interface{}) (int, map[string]string, error) {
+	var userID int
+	var name, leaveType string
+	var reason sql.NullString
+	var startDate, endDate time.Time
+	var days float64
+	err := db.QueryRow(`
+		SELECT l.user_id, u.name, l.leave_type, l.reason, l.start_date, l.end_date, l.days
+		FROM leave_requests l
+		JOIN users u ON u.id = l.user_id
+		WHERE l.id = $1
+	`, requestID).Scan(&userID, &name, &leaveType, &reason, &startDate, &endDate, &days)
+	if err != nil {
+		return 0, nil, err
+	}
+	return userID, map[string]string{
+		"applicant":  name,
+		"leave_type": leaveType,
+		"reason":     reason.String,
+		"start_date": startDate.Format("2006-01-02"),
+		"end_date":   endDate.Format("2006-01-02"),
+		"days":       strconv.FormatFloat(days, 'f', -1, 64),
+	}, nil
+}
+
+// notifyLeaveApprovers 通知当前环节的审批人有新的待审批申请，并发到申请人所在部门的群
+func (h *LeaveHandler) notifyLeaveApprovers(requestID int) {
+	go h.ChatBot.NotifyLeaveApproval(requestID)
+	if h.Notifier == nil {
+		return
+	}
+	_, data, err := leaveNotificationData(h.DB, requestID)
+	if err != nil {
+		log.Printf("load leave request %v for notification failed: %v", requestID, err)
+		return
+	}
+	approvers, err := currentStepApprovers(h.DB, requestID)
+	if err != nil {
+		log.Printf("load approvers of leave request %v failed: %v", requestID, err)
+		return
+	}
+	h.Notifier.Notify(approvers, notify.Message{
+		Event: notify.EventLeaveSubmitted,
+		Ref:   fmt.Sprintf("leave:%v", requestID),
+		Link:  "/dashboard/leave-manage",
+		Data:  data,
+	})
+}
+
+// notifyLeaveDecision 通知申请人审批结果
+func (h *LeaveHandler) notifyLeaveDecision(requestID interface{}, status string, approverID interface{}, remark string) {
+	if h.Notifier == nil {
+		return
+	}
+	applicantID, data, err := leaveNotificationData(h.DB, requestID)
+	if err != nil {
+		log.Printf("load leave request %v for notification failed: %v", requestID, err)
+		return
+	}
+	var approverName string
+	h.DB.QueryRow("SELECT name FROM users WHERE id = $1", approverID).Scan(&approverName)
+	data["approver"] = approverName
+	data["remark"] = remark
+
+	event := notify.EventLeaveApproved
+	if status == "rejected" {
+		event = notify.EventLeaveRejected
+	}
+	h.Notifier.Notify([]int{applicantID}, notify.Message{
+		Event: event,
+		Ref:   fmt.Sprintf("leave:%v", requestID),
+		Link:  "/dashboard/leave",
+		Data:  data,
+	})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateLeaveTypePolicyRequest struct {
+	// AttachmentRequiredDays 请假天数超过该值时必须上传附件，为空表示不要求
+	AttachmentRequiredDays *float64 `json:"attachment_required_days" binding:"omitempty,gte=0"`
+	// MinUnitHours 最小请假单位（小时），如 1 表示按小时、4 表示半天，为空表示不限制
+	MinUnitHours *float64 `json:"min_unit_hours" binding:"omitempty,gt=0"`
+}
+
+// attachmentRequired 判断该类型和天数的请假是否必须上传附件
+func attachmentRequired(db *sql.DB, leaveType string, days float64) (bool, error) {
+	var requiredDays sql.NullFloat64
+	err := db.QueryRow(`
+		SELECT attachment_required_days FROM leave_type_policies WHERE leave_type = $1
+	`, leaveType).Scan(&requiredDays)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return requiredDays.Valid && days > requiredDays.Float64, nil
+}
+
+// leaveMinUnitHours 返回请假类型的最小请假单位（小时），0表示不限制
+func leaveMinUnitHours(db *sql.DB, leaveType string) (float64, error) {
+	var minUnit sql.NullFloat64
+	err := db.QueryRow(`
+		SELECT min_unit_hours FROM leave_type_policies WHERE leave_type = $1
+	`, leaveType).Scan(&minUnit)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return minUnit.Float64, err
+}
+
+func (h *LeaveHandler) GetLeaveTypePolicies(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT leave_type, attachment_required_days, min_unit_hours FROM leave_type_policies ORDER BY leave_type
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假类型规则失败"})
+		return
+	}
+	defer rows.Close()
+
+	policies := []models.LeaveTypePolicy{}
+	for rows.Next() {
+		var policy models.LeaveTypePolicy
+		var requiredDays, minUnit sql.NullFloat64
+		if err := rows.Scan(&policy.LeaveType, &requiredDays, &minUnit); err != nil {
+			continue
+		}
+		if requiredDays.Valid {
+			policy.AttachmentRequiredDays = &requiredDays.Float64
+		}
+		if minUnit.Valid {
+			policy.MinUnitHours = &minUnit.Float64
+		}
+		policies = append(policies, policy)
+	}
+
+	c.JSON(http.StatusOK, policies)
+}
+
+// UpdateLeaveTypePolicy 设置请假类型的附件和最小请假单位规则，只接受申请请假时可选的类型
+func (h *LeaveHandler) UpdateLeaveTypePolicy(c *gin.Context) {
+	leaveType := c.Param("type")
+	if _, ok := models.LeaveTypeNames["zh"][leaveType]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请假类型无效"})
+		return
+	}
+	var req UpdateLeaveTypePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	_, err := h.DB.Exec(`
+		INSERT INTO leave_type_policies (leave_type, attachment_required_days, min_unit_hours)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (leave_type) DO UPDATE
+		SET attachment_required_days = EXCLUDED.attachment_required_days,
+			min_unit_hours = EXCLUDED.min_unit_hours, updated_at = CURRENT_TIMESTAMP
+	`, leaveType, req.AttachmentRequiredDays, req.MinUnitHours)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新请假类型规则失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "请假类型规则更新成功"})
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// 审批人类型：manager 为申请人所在部门中角色为manager的用户；line_manager 为申请人的直属上级，
+// 未设置直属上级时由管理员审批；department_head 为申请人所在部门的负责人，未设置负责人或负责人是申请人本人时
+// 逐级向上取上级部门的负责人，都没有时由管理员审批；role 为角色等于approver_value的任意用户（如 hr、admin）；
+// user 为approver_value指定的用户ID。
+// 未配置匹配规则时默认由管理员一级审批。
+var defaultApprovalSteps = []models.ApprovalRuleStep{
+	{StepOrder: 0, ApproverType: "role", ApproverValue: "admin"},
+}
+
+// resolveApprovalSteps 按请假类型和天数匹配审批规则，未匹配时退回由管理员一级审批。
+// 指定了请假类型的规则优先于通用规则；min_days为“大于”，max_days为“不超过”。
+func resolveApprovalSteps(db *sql.DB, leaveType string, days float64) ([]models.ApprovalRuleStep, error) {
+	var ruleID int
+	err := db.QueryRow(`
+		SELECT id FROM approval_rules
+		WHERE (leave_type IS NULL OR leave_type = '' OR leave_type = $1)
+		  AND (min_days IS NULL OR $2 > min_days)
+		  AND (max_days IS NULL OR $2 <= max_days)
+		  AND EXISTS (SELECT 1 FROM approval_rule_steps s WHERE s.rule_id = approval_rules.id)
+		ORDER BY (leave_type IS NOT NULL AND leave_type <> '') DESC, priority DESC, id
+		LIMIT 1
+	`, leaveType, days).Scan(&ruleID)
+	if err == sql.ErrNoRows {
+		return defaultApprovalSteps, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return loadApprovalRuleSteps(db, ruleID)
+}
+
+func loadApprovalRuleSteps(db *sql.DB, ruleID int) ([]models.ApprovalRuleStep, error) {
+	rows, err := db.Query(`
+		SELECT step_order, approver_type, approver_value
+		FROM approval_rule_steps
+		WHERE rule_id = $1
+		ORDER BY step_order
+	`, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	steps := []models.ApprovalRuleStep{}
+	for rows.Next() {
+		var step models.ApprovalRuleStep
+		var value sql.NullString
+		if err := rows.Scan(&step.StepOrder, &step.ApproverType, &value); err != nil {
+			return nil, err
+		}
+		step.ApproverValue = value.String
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
+
+// createApprovalSteps 将匹配到的审批环节快照到请假申请上，规则后续修改不影响进行中的申请
+func createApprovalSteps(tx *sql.Tx, requestID int, steps []models.ApprovalRuleStep) error {
+	for i, step := range steps {
+		_, err := tx.Exec(`
+			INSERT INTO leave_approval_steps (leave_request_id, step_order, approver_type, approver_value)
+			VALUES ($1, $2, $3, $4)
+		`, requestID, i, step.ApproverType, step.ApproverValue)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// departmentHeadSQL 从申请人u所在部门向上查找最近的、不是申请人本人的部门负责人
+const departmentHeadSQL = `SELECT d.head_user_id FROM department_paths p
+		JOIN departments d ON d.id = ANY(p.ancestors)
+		WHERE p.id = u.department_id AND d.head_user_id IS NOT NULL AND d.head_user_id <> u.id
+		ORDER BY array_position(p.ancestors, d.id) DESC LIMIT 1`
+
+// approverMatchCondition 返回判断用户ap能否审批当前环节的SQL条件。
+// 调用方需提供别名 l(leave_requests)、u(申请人users)、s(当前环节leave_approval_steps)、ap(审批人users)。
+const approverMatchCondition = `ap.id <> l.user_id AND (
+	(s.approver_type = 'manager' AND ap.role = 'manager' AND ap.department_id = u.department_id)
+	OR (s.approver_type = 'line_manager' AND (ap.id = u.manager_id OR (u.manager_id IS NULL AND ap.role = 'admin')))
+	OR (s.approver_type = 'department_head' AND (
+		ap.id = (` + departmentHeadSQL + `) OR ((` + departmentHeadSQL + `) IS NULL AND ap.role = 'admin')
+	))
+	OR (s.approver_type = 'role' AND ap.role = s.approver_value)
+	OR (s.approver_type = 'user' AND ap.id::text = s.approver_value)
+)`
+
+// approvalPrincipals 返回用户可代表的审批身份：本人及当前有效委托的委托人，过期委托自动失效
+func approvalPrincipals(db *sql.DB, userID int) ([]int, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT delegator_id FROM approval_delegations
+		WHERE delegate_id = $1 AND CURRENT_DATE BETWEEN start_date AND end_date
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	principals := []int{userID}
+	for rows.Next() {
+		var delegatorID int
+		if err := rows.Scan(&delegatorID); err != nil {
+			return nil, err
+		}
+		if delegatorID != userID {
+			principals = append(principals, delegatorID)
+		}
+	}
+	return principals, rows.Err()
+}
+
+// currentStepPrincipal 返回用户审批当前环节时所代表的身份，本人优先于委托人；返回0表示无权审批。
+// 即使受托代审，申请人也不能审批自己的申请
+func currentStepPrincipal(db *sql.DB, requestID interface{}, userID int) (int, error) {
+	principals, err := approvalPrincipals(db, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var principal int
+	err = db.QueryRow(`
+		SELECT ap.id FROM leave_requests l
+		JOIN users u ON u.id = l.user_id
+		JOIN leave_approval_steps s ON s.leave_request_id = l.id AND s.step_order = l.current_step
+		JOIN users ap ON ap.id = ANY($2)
+		WHERE l.id = $1 AND l.status = 'pending' AND s.status = 'pending'
+		  AND $3 <> l.user_id AND `+approverMatchCondition+`
+		ORDER BY ap.id = $3 DESC
+		LIMIT 1
+	`, requestID, pq.Array(principals), userID).Scan(&principal)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return principal, err
+}
+
+// GetPendingApprovals 获取当前环节等待本人（或委托本人代审的人）审批的请假申请
+func (h *LeaveHandler) GetPendingApprovals(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	principals, err := approvalPrincipals(h.DB, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审批委托失败"})
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT * FROM (
+			SELECT l.id, l.user_id, u.name, u.department,
+				   l.leave_type, l.start_date, l.end_date, l.days,
+				   l.reason, l.status, l.current_step, l.created_at, l.updated_at,
+				   (SELECT ap.id FROM users ap
+					WHERE ap.id = ANY($1) AND `+approverMatchCondition+`
+					ORDER BY ap.id = $2 DESC LIMIT 1) AS principal_id
+			FROM leave_requests l
+			JOIN users u ON l.user_id = u.id
+			JOIN leave_approval_steps s ON s.leave_request_id = l.id AND s.step_order = l.current_step
+			WHERE l.status = 'pending' AND s.status = 'pending' AND l.user_id <> $2
+		) pending
+		WHERE principal_id IS NOT NULL
+		ORDER BY created_at
+	`, pq.Array(principals), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取待审批申请失败"})
+		return
+	}
+	defer rows.Close()
+
+	type LeaveRequestWithUser struct {
+		models.LeaveRequest
+		UserName       string `json:"user_name"`
+		UserDepartment string `json:"user_department"`
+		OnBehalfOf     *int   `json:"on_behalf_of,omitempty"`
+	}
+
+	requests := []LeaveRequestWithUser{}
+	for rows.Next() {
+		var req LeaveRequestWithUser
+		var dept sql.NullString
+		var principalID int
+		err := rows.Scan(
+			&req.ID, &req.UserID, &req.UserName, &dept,
+			&req.LeaveType, &req.StartDate, &req.EndDate, &req.Days,
+			&req.Reason, &req.Status, &req.CurrentStep, &req.CreatedAt, &req.UpdatedAt,
+			&principalID,
+		)
+		if err != nil {
+			continue
+		}
+		req.UserDepartment = dept.String
+		if principalID != userID.(int) {
+			req.OnBehalfOf = &principalID
+		}
+		requests = append(requests, req)
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// GetLeaveApprovalSteps 获取请假申请的审批环节及审批记录
+func (h *LeaveHandler) GetLeaveApprovalSteps(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	var currentStep int
+	err := h.DB.QueryRow("SELECT current_step FROM leave_requests WHERE id = $1", id).Scan(&currentStep)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "请假申请不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取请假申请失败"})
+		return
+	}
+
+	allowed, err := canViewLeaveRequest(h.DB, id, userID.(int), role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查访问权限失败"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问"})
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT s.id, s.step_order, s.approver_type, s.approver_value, s.status,
+			   s.acted_by, a.name, s.on_behalf_of, b.name, s.acted_at, s.remark
+		FROM leave_approval_steps s
+		LEFT JOIN users a ON a.id = s.acted_by
+		LEFT JOIN users b ON b.id = s.on_behalf_of
+		WHERE s.leave_request_id = $1
+		ORDER BY s.step_order
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审批记录失败"})
+		return
+	}
+	defer rows.Close()
+
+	steps := []models.LeaveApprovalStep{}
+	for rows.Next() {
+		var step models.LeaveApprovalStep
+		var value, actedByName, onBehalfName, remark sql.NullString
+		var actedBy, onBehalfOf sql.NullInt64
+		var actedAt sql.NullTime
+		err := rows.Scan(
+			&step.ID, &step.StepOrder, &step.ApproverType, &value, &step.Status,
+			&actedBy, &actedByName, &onBehalfOf, &onBehalfName, &actedAt, &remark,
+		)
+		if err != nil {
+			continue
+		}
+		step.ApproverValue = value.String
+		if actedBy.Valid {
+			aid := int(actedBy.Int64)
+			step.ActedBy = &aid
+		}
+		step.ActedByName = actedByName.String
+		if onBehalfOf.Valid {
+			bid := int(onBehalfOf.Int64)
+			step.OnBehalfOf = &bid
+		}
+		step.OnBehalfName = onBehalfName.String
+		if actedAt.Valid {
+			step.ActedAt = &actedAt.Time
+		}
+		step.Remark = remark.String
+		steps = append(steps, step)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"current_step": currentStep,
+		"steps":        steps,
+	})
+}
+
+// canViewLeaveRequest 判断用户能否查看请假申请详情：管理员、申请人、参与过审批的人以及当前环节的审批人（含受委托人）
+func canViewLeaveRequest(db *sql.DB, requestID interface{}, userID int, role interface{}) (bool, error) {
+	if role == "admin" {
+		return true, nil
+	}
+
+	var visible bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM leave_requests l
+			WHERE l.id = $1 AND (
+				l.user_id = $2 OR l.approver_id = $2 OR EXISTS (
+					SELECT 1 FROM leave_approval_steps s
+					WHERE s.leave_request_id = l.id AND (s.acted_by = $2 OR s.on_behalf_of = $2)
+				)
+			)
+		)
+	`, requestID, userID).Scan(&visible)
+	if err != nil || visible {
+		return visible, err
+	}
+
+	principal, err := currentStepPrincipal(db, requestID, userID)
+	return principal != 0, err
+}
+
+// validateApprovalStep 校验审批环节配置
+func validateApprovalStep(approverType, approverValue string) bool {
+	switch approverType {
+	case "manager", "line_manager", "department_head":
+		return true
+	case "role":
+		return approverValue != ""
+	case "user":
+		_, err := strconv.Atoi(approverValue)
+		return err == nil
+	}
+	return false
+}
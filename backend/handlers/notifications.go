@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"greentech-attendance/models"
+	"greentech-attendance/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationHandler struct {
+	DB *sql.DB
+}
+
+type UpdateNotificationPreferencesRequest struct {
+	Language    string                          `json:"language" binding:"omitempty,oneof=zh en"`
+	Preferences []models.NotificationPreference `json:"preferences"`
+}
+
+func (h *NotificationHandler) GetNotifications(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	unreadOnly := c.Query("unread") == "true"
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT id, event, title, COALESCE(body, ''), COALESCE(link, ''), read_at, created_at
+		FROM notifications
+		WHERE user_id = $1 AND ($2 = false OR read_at IS NULL)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, userID, unreadOnly, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取通知失败"})
+		return
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.Event, &n.Title, &n.Body, &n.Link, &readAt, &n.CreatedAt); err != nil {
+			continue
+		}
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, n)
+	}
+
+	var unreadCount int
+	h.DB.QueryRow(`
+		SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL
+	`, userID).Scan(&unreadCount)
+
+	c.JSON(http.StatusOK, gin.H{
+		"unread_count":  unreadCount,
+		"notifications": notifications,
+	})
+}
+
+func (h *NotificationHandler) MarkNotificationRead(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	result, err := h.DB.Exec(`
+		UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND user_id = $2
+	`, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新通知失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "通知不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已标记为已读"})
+}
+
+func (h *NotificationHandler) MarkAllNotificationsRead(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	_, err := h.DB.Exec(`
+		UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND read_at IS NULL
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新通知失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已全部标记为已读"})
+}
+
+// GetNotificationPreferences 返回所有事件的通知偏好，未设置的事件默认站内信和邮件都开启
+func (h *NotificationHandler) GetNotificationPreferences(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var language sql.NullString
+	if err := h.DB.QueryRow("SELECT language FROM users WHERE id = $1", userID).Scan(&language); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取通知设置失败"})
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT event, in_app, email FROM notification_preferences WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取通知设置失败"})
+		return
+	}
+	defer rows.Close()
+
+	saved := map[string]models.NotificationPreference{}
+	for rows.Next() {
+		var p models.NotificationPreference
+		if err := rows.Scan(&p.Event, &p.InApp, &p.Email); err != nil {
+			continue
+		}
+		saved[p.Event] = p
+	}
+
+	preferences := []models.NotificationPreference{}
+	for _, event := range notify.Events {
+		p, ok := saved[event]
+		if !ok {
+			p = models.NotificationPreference{Event: event, InApp: true, Email: true}
+		}
+		preferences = append(preferences, p)
+	}
+
+	if !language.Valid || language.String == "" {
+		language.String = "zh"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"language":    language.String,
+		"preferences": preferences,
+	})
+}
+
+func (h *NotificationHandler) UpdateNotificationPreferences(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req UpdateNotificationPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	known := map[string]bool{}
+	for _, event := range notify.Events {
+		known[event] = true
+	}
+	for _, p := range req.Preferences {
+		if !known[p.Event] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未知的通知事件: " + p.Event})
+			return
+		}
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	if req.Language != "" {
+		if _, err := tx.Exec("UPDATE users SET language = $1 WHERE id = $2", req.Language, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新通知设置失败"})
+			return
+		}
+	}
+	for _, p := range req.Preferences {
+		_, err := tx.Exec(`
+			INSERT INTO notification_preferences (user_id, event, in_app, email)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, event) DO UPDATE SET in_app = EXCLUDED.in_app, email = EXCLUDED.email
+		`, userID, p.Event, p.InApp, p.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新通知设置失败"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "通知设置已更新"})
+}
@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"greentech-attendance/config"
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PayrollHandler struct {
+	DB  *sql.DB
+	Cfg *config.Config
+}
+
+type PayrollPeriodRequest struct {
+	Name      string `json:"name" binding:"required"`
+	StartDate string `json:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" binding:"required"`
+}
+
+type PayrollTemplateRequest struct {
+	Name      string                 `json:"name" binding:"required"`
+	Columns   []models.PayrollColumn `json:"columns" binding:"required,min=1"`
+	IsDefault bool                   `json:"is_default"`
+}
+
+// lockedPayrollPeriod 返回与日期区间重叠的已锁定薪资期间名称，没有时返回空字符串。
+// 已锁定期间内的考勤和请假数据不允许再修改
+func lockedPayrollPeriod(db *sql.DB, from, to time.Time) (string, error) {
+	var name string
+	err := db.QueryRow(`
+		SELECT name FROM payroll_periods
+		WHERE status = 'locked' AND start_date <= $2 AND end_date >= $1
+		ORDER BY start_date
+		LIMIT 1
+	`, from, to).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return name, err
+}
+
+// checkPayrollUnlocked 区间落在已锁定期间时返回错误响应，返回 false 表示调用方应终止处理
+func checkPayrollUnlocked(c *gin.Context, db *sql.DB, from, to time.Time) bool {
+	name, err := lockedPayrollPeriod(db, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查薪资期间失败"})
+		return false
+	}
+	if name != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("薪资期间「%s」已锁定，不能修改该期间的记录", name)})
+		return false
+	}
+	return true
+}
+
+func scanPayrollPeriod(row interface{ Scan(...interface{}) error }) (models.PayrollPeriod, error) {
+	var p models.PayrollPeriod
+	var startDate, endDate time.Time
+	var lockedAt sql.NullTime
+	var lockedBy sql.NullInt64
+	err := row.Scan(&p.ID, &p.Name, &startDate, &endDate, &p.Status, &lockedAt, &lockedBy, &p.CreatedAt)
+	if err != nil {
+		return p, err
+	}
+	p.StartDate = startDate.Format("2006-01-02")
+	p.EndDate = endDate.Format("2006-01-02")
+	if lockedAt.Valid {
+		p.LockedAt = &lockedAt.Time
+	}
+	if lockedBy.Valid {
+		id := int(lockedBy.Int64)
+		p.LockedBy = &id
+	}
+	return p, nil
+}
+
+const payrollPeriodColumns = `id, name, start_date, end_date, status, locked_at, locked_by, created_at`
+
+func (h *PayrollHandler) GetPayrollPeriods(c *gin.Context) {
+	rows, err := h.DB.Query(`SELECT ` + payrollPeriodColumns + ` FROM payroll_periods ORDER BY start_date DESC`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取薪资期间失败"})
+		return
+	}
+	defer rows.Close()
+
+	periods := []models.PayrollPeriod{}
+	for rows.Next() {
+		p, err := scanPayrollPeriod(rows)
+		if err != nil {
+			continue
+		}
+		periods = append(periods, p)
+	}
+
+	c.JSON(http.StatusOK, periods)
+}
+
+func (h *PayrollHandler) CreatePayrollPeriod(c *gin.Context) {
+	var req PayrollPeriodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	startDate, err1 := time.Parse("2006-01-02", req.StartDate)
+	endDate, err2 := time.Parse("2006-01-02", req.EndDate)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式错误"})
+		return
+	}
+	if endDate.Before(startDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结束日期不能早于开始日期"})
+		return
+	}
+
+	var overlapping string
+	err := h.DB.QueryRow(`
+		SELECT name FROM payroll_periods WHERE start_date <= $2 AND end_date >= $1 LIMIT 1
+	`, startDate, endDate).Scan(&overlapping)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("与已有薪资期间「%s」重叠", overlapping)})
+		return
+	}
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建薪资期间失败"})
+		return
+	}
+
+	period, err := scanPayrollPeriod(h.DB.QueryRow(`
+		INSERT INTO payroll_periods (name, start_date, end_date)
+		VALUES ($1, $2, $3)
+		RETURNING `+payrollPeriodColumns, req.Name, startDate, endDate))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建薪资期间失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, period)
+}
+
+// LockPayrollPeriod 锁定薪资期间，之后该期间内的考勤和请假不能再修改
+func (h *PayrollHandler) LockPayrollPeriod(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	h.setPayrollPeriodStatus(c, "locked", userID)
+}
+
+// ReopenPayrollPeriod 重新开放已锁定的期间，用于更正错误后再次锁定
+func (h *PayrollHandler) ReopenPayrollPeriod(c *gin.Context) {
+	h.setPayrollPeriodStatus(c, "open", nil)
+}
+
+func (h *PayrollHandler) setPayrollPeriodStatus(c *gin.Context, status string, lockedBy interface{}) {
+	period, err := scanPayrollPeriod(h.DB.QueryRow(`
+		UPDATE payroll_periods
+		SET status = $1,
+			locked_at = CASE WHEN $1 = 'locked' THEN CURRENT_TIMESTAMP END,
+			locked_by = $2
+		WHERE id = $3
+		RETURNING `+payrollPeriodColumns, status, lockedBy, c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "薪资期间不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新薪资期间失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, period)
+}
+
+func (h *PayrollHandler) loadPeriod(c *gin.Context) (models.PayrollPeriod, time.Time, time.Time, bool) {
+	period, err := scanPayrollPeriod(h.DB.QueryRow(`
+		SELECT `+payrollPeriodColumns+` FROM payroll_periods WHERE id = $1
+	`, c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "薪资期间不存在"})
+		return period, time.Time{}, time.Time{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取薪资期间失败"})
+		return period, time.Time{}, time.Time{}, false
+	}
+	start, _ := time.Parse("2006-01-02", period.StartDate)
+	end, _ := time.Parse("2006-01-02", period.EndDate)
+	return period, start, end, true
+}
+
+// GetPayrollSummary 返回期间内每位员工的薪资计算数据
+func (h *PayrollHandler) GetPayrollSummary(c *gin.Context) {
+	period, start, end, ok := h.loadPeriod(c)
+	if !ok {
+		return
+	}
+	departmentID, ok := departmentIDParam(c)
+	if !ok {
+		return
+	}
+
+	summaries, err := computePayroll(h.DB, h.Cfg, start, end, departmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "计算薪资数据失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period":    period,
+		"summaries": summaries,
+	})
+}
+
+// ExportPayroll 按模板的列映射导出薪资数据，未指定模板时使用默认模板
+func (h *PayrollHandler) ExportPayroll(c *gin.Context) {
+	period, start, end, ok := h.loadPeriod(c)
+	if !ok {
+		return
+	}
+	departmentID, ok := departmentIDParam(c)
+	if !ok {
+		return
+	}
+
+	columns := defaultPayrollColumns()
+	templateID := c.Query("template_id")
+	var raw []byte
+	var err error
+	if templateID != "" {
+		err = h.DB.QueryRow("SELECT columns FROM payroll_templates WHERE id = $1", templateID).Scan(&raw)
+	} else {
+		err = h.DB.QueryRow("SELECT columns FROM payroll_templates WHERE is_default ORDER BY id LIMIT 1").Scan(&raw)
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "导出模板不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取导出模板失败"})
+		return
+	}
+	if raw != nil {
+		if err := json.Unmarshal(raw, &columns); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "导出模板格式错误"})
+			return
+		}
+	}
+
+	summaries, err := computePayroll(h.DB, h.Cfg, start, end, departmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "计算薪资数据失败"})
+		return
+	}
+
+	w := startExport(c, fmt.Sprintf("payroll_%s_%s", period.StartDate, period.EndDate), "薪资数据")
+	if w == nil {
+		return
+	}
+	header := make([]interface{}, len(columns))
+	for i, col := range columns {
+		header[i] = col.Header
+	}
+	w.WriteRow(header)
+	for i := range summaries {
+		row := make([]interface{}, len(columns))
+		for j, col := range columns {
+			if f, ok := findPayrollField(col.Field); ok {
+				row[j] = f.Value(&summaries[i])
+			}
+		}
+		if err := w.WriteRow(row); err != nil {
+			log.Printf("export payroll failed: %v", err)
+			return
+		}
+	}
+	if err := w.Close(); err != nil {
+		log.Printf("export payroll failed: %v", err)
+	}
+}
+
+// GetPayrollFields 返回模板可映射的字段
+func (h *PayrollHandler) GetPayrollFields(c *gin.Context) {
+	fields := make([]gin.H, len(payrollFields))
+	for i, f := range payrollFields {
+		fields[i] = gin.H{"field": f.Key, "label": f.Label}
+	}
+	c.JSON(http.StatusOK, fields)
+}
+
+func validPayrollTemplate(req PayrollTemplateRequest) bool {
+	for _, col := range req.Columns {
+		if col.Header == "" {
+			return false
+		}
+		if _, ok := findPayrollField(col.Field); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *PayrollHandler) GetPayrollTemplates(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT id, name, columns, is_default, created_at, updated_at
+		FROM payroll_templates ORDER BY id
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取导出模板失败"})
+		return
+	}
+	defer rows.Close()
+
+	templates := []models.PayrollTemplate{}
+	for rows.Next() {
+		var t models.PayrollTemplate
+		var raw []byte
+		if err := rows.Scan(&t.ID, &t.Name, &raw, &t.IsDefault, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			continue
+		}
+		if err := json.Unmarshal(raw, &t.Columns); err != nil {
+			continue
+		}
+		templates = append(templates, t)
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+func (h *PayrollHandler) CreatePayrollTemplate(c *gin.Context) {
+	h.savePayrollTemplate(c, "")
+}
+
+func (h *PayrollHandler) UpdatePayrollTemplate(c *gin.Context) {
+	h.savePayrollTemplate(c, c.Param("id"))
+}
+
+// savePayrollTemplate 新建或更新模板；设为默认时取消其他模板的默认标记
+func (h *PayrollHandler) savePayrollTemplate(c *gin.Context, id string) {
+	var req PayrollTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validPayrollTemplate(req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	columns, _ := json.Marshal(req.Columns)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	if req.IsDefault {
+		if _, err := tx.Exec("UPDATE payroll_templates SET is_default = FALSE WHERE is_default"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存导出模板失败"})
+			return
+		}
+	}
+
+	var templateID int
+	if id == "" {
+		err = tx.QueryRow(`
+			INSERT INTO payroll_templates (name, columns, is_default)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, req.Name, columns, req.IsDefault).Scan(&templateID)
+	} else {
+		err = tx.QueryRow(`
+			UPDATE payroll_templates
+			SET name = $1, columns = $2, is_default = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $4
+			RETURNING id
+		`, req.Name, columns, req.IsDefault, id).Scan(&templateID)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "导出模板不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存导出模板失败"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+
+	if id == "" {
+		c.JSON(http.StatusCreated, gin.H{"message": "导出模板创建成功", "id": templateID})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "导出模板更新成功"})
+}
+
+func (h *PayrollHandler) DeletePayrollTemplate(c *gin.Context) {
+	result, err := h.DB.Exec("DELETE FROM payroll_templates WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除导出模板失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "导出模板不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+
+	"greentech-attendance/config"
+	"greentech-attendance/models"
+)
+
+// payrollField 薪资导出可选的字段，Label 为默认模板的表头
+type payrollField struct {
+	Key   string
+	Label string
+	Value func(s *models.PayrollSummary) interface{}
+}
+
+var payrollFields = []payrollField{
+	{"user_id", "员工ID", func(s *models.PayrollSummary) interface{} { return s.UserID }},
+	{"username", "工号", func(s *models.PayrollSummary) interface{} { return s.Username }},
+	{"name", "姓名", func(s *models.PayrollSummary) interface{} { return s.Name }},
+	{"department", "部门", func(s *models.PayrollSummary) interface{} { return s.Department }},
+	{"position", "职位", func(s *models.PayrollSummary) interface{} { return s.Position }},
+	{"working_days", "应出勤天数", func(s *models.PayrollSummary) interface{} { return s.WorkingDays }},
+	{"days_attended", "实际出勤天数", func(s *models.PayrollSummary) interface{} { return s.DaysAttended }},
+	{"absent_days", "缺勤天数", func(s *models.PayrollSummary) interface{} { return s.AbsentDays }},
+	{"unpaid_leave_days", "无薪假天数", func(s *models.PayrollSummary) interface{} { return s.UnpaidLeaveDays }},
+	{"paid_leave_days", "带薪假天数", func(s *models.PayrollSummary) interface{} { return s.PaidLeaveDays }},
+	{"annual_leave_days", "年假天数", func(s *models.PayrollSummary) interface{} { return s.AnnualLeaveDays }},
+	{"sick_leave_days", "病假天数", func(s *models.PayrollSummary) interface{} { return s.SickLeaveDays }},
+	{"personal_leave_days", "事假天数", func(s *models.PayrollSummary) interface{} { return s.PersonalLeaveDays }},
+	{"other_leave_days", "其他假天数", func(s *models.PayrollSummary) interface{} { return s.OtherLeaveDays }},
+	{"late_count", "迟到次数", func(s *models.PayrollSummary) interface{} { return s.LateCount }},
+	{"overtime_hours", "加班小时数", func(s *models.PayrollSummary) interface{} { return s.OvertimeHours }},
+	{"office_days", "办公室出勤天数", func(s *models.PayrollSummary) interface{} { return s.OfficeDays }},
+	{"remote_days", "远程出勤天数", func(s *models.PayrollSummary) interface{} { return s.RemoteDays }},
+	{"field_days", "外勤出勤天数", func(s *models.PayrollSummary) interface{} { return s.FieldDays }},
+	{"trip_days", "出差天数", func(s *models.PayrollSummary) interface{} { return s.TripDays }},
+}
+
+func findPayrollField(key string) (payrollField, bool) {
+	for _, f := range payrollFields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return payrollField{}, false
+}
+
+// defaultPayrollColumns 未配置模板时导出全部字段
+func defaultPayrollColumns() []models.PayrollColumn {
+	columns := make([]models.PayrollColumn, len(payrollFields))
+	for i, f := range payrollFields {
+		columns[i] = models.PayrollColumn{Header: f.Label, Field: f.Key}
+	}
+	return columns
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// isLateCheckIn 签到时间晚于班次开始时间即为迟到
+func isLateCheckIn(cfg *config.Config, checkIn time.Time) bool {
+	return checkIn.Hour()*60+checkIn.Minute() > parseClock(cfg.WorkStartTime, 9*60)
+}
+
+// overtimeHours 当天工作时长超过标准工时的部分
+func overtimeHours(cfg *config.Config, checkIn, checkOut time.Time) float64 {
+	return math.Max(0, workedHours(cfg, checkIn, checkOut)-workHoursPerDay(cfg))
+}
+
+// workedHours 签到到签退之间扣除午休后的工作时长
+func workedHours(cfg *config.Config, checkIn, checkOut time.Time) float64 {
+	worked := checkOut.Sub(checkIn).Minutes()
+	day := time.Date(checkIn.Year(), checkIn.Month(), checkIn.Day(), 0, 0, 0, 0, checkIn.Location())
+	breakStart := day.Add(time.Duration(parseClock(cfg.BreakStartTime, 12*60)) * time.Minute)
+	breakEnd := day.Add(time.Duration(parseClock(cfg.BreakEndTime, 13*60)) * time.Minute)
+	if checkIn.After(breakStart) {
+		breakStart = checkIn
+	}
+	if checkOut.Before(breakEnd) {
+		breakEnd = checkOut
+	}
+	if breakEnd.After(breakStart) {
+		worked -= breakEnd.Sub(breakStart).Minutes()
+	}
+	return math.Max(0, worked/60)
+}
+
+// computePayroll 按期间汇总每位员工的出勤、请假、迟到和加班数据，departmentID 不为0时只统计该部门及其下级部门
+func computePayroll(db *sql.DB, cfg *config.Config, start, end time.Time, departmentID int) ([]models.PayrollSummary, error) {
+	holidays, err := holidaysInRange(db, start, end)
+	if err != nil {
+		return nil, err
+	}
+	workdays := map[string]bool{}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format("2006-01-02")
+		if isWorkday(d) && holidays[key] == "" {
+			workdays[key] = true
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.name, COALESCE(u.department, ''), COALESCE(u.position, '')
+		FROM users u
+		LEFT JOIN department_paths dp ON dp.id = u.department_id
+		WHERE `+inDepartmentTree("$1")+`
+		ORDER BY dp.path NULLS LAST, u.name
+	`, departmentID)
+	if err != nil {
+		return nil, err
+	}
+	summaries := []models.PayrollSummary{}
+	index := map[int]int{}
+	for rows.Next() {
+		s := models.PayrollSummary{WorkingDays: len(workdays)}
+		if err := rows.Scan(&s.UserID, &s.Username, &s.Name, &s.Department, &s.Position); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[s.UserID] = len(summaries)
+		summaries = append(summaries, s)
+	}
+	rows.Close()
+
+	// 出勤、迟到、加班，出勤天数按考勤方式分别统计
+	rows, err = db.Query(`
+		SELECT user_id, check_in_time, check_out_time, mode FROM attendance_records
+		WHERE DATE(check_in_time) BETWEEN $1 AND $2
+	`, start, end)
+	if err != nil {
+		return nil, err
+	}
+	attendedWorkdays := map[int]map[string]bool{}
+	attendedDays := map[int]map[string]bool{}
+	for rows.Next() {
+		var userID int
+		var checkIn time.Time
+		var checkOut sql.NullTime
+		var mode string
+		if err := rows.Scan(&userID, &checkIn, &checkOut, &mode); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		i, ok := index[userID]
+		if !ok {
+			continue
+		}
+		key := checkIn.Format("2006-01-02")
+		if attendedDays[userID] == nil {
+			attendedDays[userID] = map[string]bool{}
+			attendedWorkdays[userID] = map[string]bool{}
+		}
+		if !attendedDays[userID][key] {
+			switch mode {
+			case "remote":
+				summaries[i].RemoteDays++
+			case "field":
+				summaries[i].FieldDays++
+			default:
+				summaries[i].OfficeDays++
+			}
+		}
+		attendedDays[userID][key] = true
+		if workdays[key] {
+			attendedWorkdays[userID][key] = true
+			if isLateCheckIn(cfg, checkIn) {
+				summaries[i].LateCount++
+			}
+		}
+		if checkOut.Valid {
+			summaries[i].OvertimeHours += overtimeHours(cfg, checkIn, checkOut.Time)
+		}
+	}
+	rows.Close()
+
+	// 请假：跨期间的申请按期间内工作日占比计入；出差的工作日按出勤计算
+	rows, err = db.Query(`
+		SELECT user_id, leave_type, start_date, end_date, days FROM leave_requests
+		WHERE status IN ('approved', 'cancel_pending') AND start_date <= $2 AND end_date >= $1
+	`, start, end)
+	if err != nil {
+		return nil, err
+	}
+	type leaveRow struct {
+		userID     int
+		leaveType  string
+		start, end time.Time
+		days       float64
+	}
+	leaves := []leaveRow{}
+	var spanStart, spanEnd time.Time
+	for rows.Next() {
+		var l leaveRow
+		if err := rows.Scan(&l.userID, &l.leaveType, &l.start, &l.end, &l.days); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if len(leaves) == 0 || l.start.Before(spanStart) {
+			spanStart = l.start
+		}
+		if len(leaves) == 0 || l.end.After(spanEnd) {
+			spanEnd = l.end
+		}
+		leaves = append(leaves, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 按请假整个期间的节假日计算工作日占比，跨出统计期间的部分同样不计节假日
+	leaveHolidays := map[string]string{}
+	if len(leaves) > 0 {
+		leaveHolidays, err = holidaysInRange(db, spanStart, spanEnd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	unpaid := map[string]bool{}
+	tripDays := map[int]map[string]bool{}
+	for _, t := range strings.Split(cfg.UnpaidLeaveTypes, ",") {
+		unpaid[strings.TrimSpace(t)] = true
+	}
+	for _, l := range leaves {
+		i, ok := index[l.userID]
+		if !ok {
+			continue
+		}
+
+		if l.leaveType == "business_trip" {
+			for d := l.start; !d.After(l.end); d = d.AddDate(0, 0, 1) {
+				key := d.Format("2006-01-02")
+				if !workdays[key] {
+					continue
+				}
+				if attendedDays[l.userID] == nil {
+					attendedDays[l.userID] = map[string]bool{}
+					attendedWorkdays[l.userID] = map[string]bool{}
+				}
+				if tripDays[l.userID] == nil {
+					tripDays[l.userID] = map[string]bool{}
+				}
+				if !tripDays[l.userID][key] {
+					summaries[i].TripDays++
+				}
+				tripDays[l.userID][key] = true
+				attendedDays[l.userID][key] = true
+				attendedWorkdays[l.userID][key] = true
+			}
+			continue
+		}
+
+		total, inPeriod := 0, 0
+		for d := l.start; !d.After(l.end); d = d.AddDate(0, 0, 1) {
+			if !isChargeableDay(d, leaveHolidays) {
+				continue
+			}
+			total++
+			if workdays[d.Format("2006-01-02")] {
+				inPeriod++
+			}
+		}
+		share := l.days
+		if total > 0 {
+			share = l.days * float64(inPeriod) / float64(total)
+		}
+		if share == 0 {
+			continue
+		}
+
+		s := &summaries[i]
+		switch l.leaveType {
+		case "annual":
+			s.AnnualLeaveDays += share
+		case "sick":
+			s.SickLeaveDays += share
+		case "personal":
+			s.PersonalLeaveDays += share
+		default:
+			s.OtherLeaveDays += share
+		}
+		if unpaid[l.leaveType] {
+			s.UnpaidLeaveDays += share
+		} else {
+			s.PaidLeaveDays += share
+		}
+	}
+
+	for i := range summaries {
+		s := &summaries[i]
+		s.DaysAttended = len(attendedDays[s.UserID])
+		leaveDays := s.UnpaidLeaveDays + s.PaidLeaveDays
+		s.AbsentDays = round2(math.Max(0, float64(s.WorkingDays-len(attendedWorkdays[s.UserID]))-leaveDays))
+		s.UnpaidLeaveDays = round2(s.UnpaidLeaveDays)
+		s.PaidLeaveDays = round2(s.PaidLeaveDays)
+		s.AnnualLeaveDays = round2(s.AnnualLeaveDays)
+		s.SickLeaveDays = round2(s.SickLeaveDays)
+		s.PersonalLeaveDays = round2(s.PersonalLeaveDays)
+		s.OtherLeaveDays = round2(s.OtherLeaveDays)
+		s.OvertimeHours = round2(s.OvertimeHours)
+	}
+	return summaries, nil
+}
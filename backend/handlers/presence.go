@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"greentech-attendance/config"
+	"greentech-attendance/middleware"
+	"greentech-attendance/presence"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// presenceHeartbeat 心跳间隔，防止代理因连接空闲而断开
+const presenceHeartbeat = 25 * time.Second
+
+type PresenceHandler struct {
+	DB  *sql.DB
+	Cfg *config.Config
+	Bus *presence.Bus
+}
+
+// PresenceMember 连接时快照中的成员状态：in 在岗，out 已签退，on_leave 请假中，on_trip 出差中，not_in 未签到
+type PresenceMember struct {
+	UserID       int        `json:"user_id"`
+	UserName     string     `json:"user_name"`
+	Department   string     `json:"department"`
+	Status       string     `json:"status"`
+	CheckInTime  *time.Time `json:"check_in_time,omitempty"`
+	CheckOutTime *time.Time `json:"check_out_time,omitempty"`
+	LeaveType    string     `json:"leave_type,omitempty"`
+}
+
+// publishPresence 补全用户姓名和部门后发布事件；查询失败只记录日志，不影响业务请求
+func publishPresence(db *sql.DB, bus *presence.Bus, e presence.Event) {
+	if bus == nil {
+		return
+	}
+	var department sql.NullString
+	var ancestors []int64
+	err := db.QueryRow(`
+		SELECT u.name, u.department, p.ancestors
+		FROM users u
+		LEFT JOIN department_paths p ON p.id = u.department_id
+		WHERE u.id = $1
+	`, e.UserID).Scan(&e.UserName, &department, pq.Array(&ancestors))
+	if err != nil {
+		log.Printf("publish presence event for user %d failed: %v", e.UserID, err)
+		return
+	}
+	e.Department = department.String
+	for _, id := range ancestors {
+		e.Departments = append(e.Departments, int(id))
+	}
+	bus.Publish(e)
+}
+
+// publishLeaveStatus 请假申请状态变化时发布事件
+func publishLeaveStatus(db *sql.DB, bus *presence.Bus, requestID interface{}) {
+	if bus == nil {
+		return
+	}
+	e := presence.Event{Type: presence.EventLeaveStatus}
+	var startDate, endDate time.Time
+	err := db.QueryRow(`
+		SELECT id, user_id, status, leave_type, start_date, end_date FROM leave_requests WHERE id = $1
+	`, requestID).Scan(&e.RequestID, &e.UserID, &e.Status, &e.LeaveType, &startDate, &endDate)
+	if err != nil {
+		log.Printf("publish presence event for leave request %v failed: %v", requestID, err)
+		return
+	}
+	e.StartDate = startDate.Format("2006-01-02")
+	e.EndDate = endDate.Format("2006-01-02")
+	publishPresence(db, bus, e)
+}
+
+// StreamToken 签发打开推送连接用的短期令牌，前端以 access_token 查询参数传给 Stream
+func (h *PresenceHandler) StreamToken(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	username, _ := c.Get("username")
+	role, _ := c.Get("role")
+
+	token, err := middleware.GenerateStreamToken(userID.(int), username.(string), role.(string), h.Cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成推送令牌失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_in": int(middleware.StreamTokenTTL.Seconds()),
+	})
+}
+
+// Stream 以 Server-Sent Events 推送在岗状态：连接时先发送 snapshot，之后推送签到、签退和请假状态变化。
+// 可见范围与团队日历一致：管理员和HR可按 department_id 查看任意部门（不指定部门时为全部），
+// 其他人只能查看本部门；均包含下级部门，普通员工看不到请假类型
+func (h *PresenceHandler) Stream(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	departmentID, ok := departmentIDParam(c)
+	if !ok {
+		return
+	}
+	var ownDepartmentID sql.NullInt64
+	if err := h.DB.QueryRow("SELECT department_id FROM users WHERE id = $1", userID).Scan(&ownDepartmentID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
+		return
+	}
+	fullAccess := role == "admin" || role == "hr"
+	if !fullAccess {
+		if !ownDepartmentID.Valid || (departmentID != 0 && departmentID != int(ownDepartmentID.Int64)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只能查看本部门的在岗状态"})
+			return
+		}
+		departmentID = int(ownDepartmentID.Int64)
+	}
+	allDepartments := departmentID == 0
+	showDetails := fullAccess || role == "manager"
+
+	// 先订阅再查询快照，避免两者之间发生的变化丢失
+	events, unsubscribe := h.Bus.Subscribe()
+	defer unsubscribe()
+
+	members, err := h.snapshot(departmentID, showDetails)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取在岗状态失败"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if !writeSSE(c, "snapshot", gin.H{"department_id": departmentID, "members": members}) {
+		return
+	}
+
+	heartbeat := time.NewTicker(presenceHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case e := <-events:
+			if !allDepartments && !e.InDepartment(departmentID) {
+				continue
+			}
+			if !showDetails {
+				e.LeaveType = ""
+			}
+			if !writeSSE(c, e.Type, e) {
+				return
+			}
+		}
+	}
+}
+
+func writeSSE(c *gin.Context, event string, data interface{}) bool {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return false
+	}
+	if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return false
+	}
+	c.Writer.Flush()
+	return true
+}
+
+func (h *PresenceHandler) snapshot(departmentID int, showDetails bool) ([]PresenceMember, error) {
+	today := time.Now().Format("2006-01-02")
+	rows, err := h.DB.Query(`
+		SELECT u.id, u.name, COALESCE(u.department, ''), a.check_in_time, a.check_out_time,
+			   (SELECT l.leave_type FROM leave_requests l
+				WHERE l.user_id = u.id AND l.status IN ('approved', 'cancel_pending')
+				  AND $1 BETWEEN l.start_date AND l.end_date
+				ORDER BY l.id LIMIT 1)
+		FROM users u
+		LEFT JOIN LATERAL (
+			SELECT check_in_time, check_out_time FROM attendance_records
+			WHERE user_id = u.id AND DATE(check_in_time) = $1
+			ORDER BY check_in_time DESC LIMIT 1
+		) a ON TRUE
+		WHERE `+inDepartmentTree("$2")+`
+		ORDER BY u.department, u.name
+	`, today, departmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []PresenceMember{}
+	for rows.Next() {
+		var m PresenceMember
+		var checkIn, checkOut sql.NullTime
+		var leaveType sql.NullString
+		if err := rows.Scan(&m.UserID, &m.UserName, &m.Department, &checkIn, &checkOut, &leaveType); err != nil {
+			return nil, err
+		}
+		switch {
+		case checkOut.Valid:
+			m.Status = "out"
+		case checkIn.Valid:
+			m.Status = "in"
+		case leaveType.String == "business_trip":
+			m.Status = "on_trip"
+		case leaveType.Valid:
+			m.Status = "on_leave"
+		default:
+			m.Status = "not_in"
+		}
+		if checkIn.Valid {
+			m.CheckInTime = &checkIn.Time
+		}
+		if checkOut.Valid {
+			m.CheckOutTime = &checkOut.Time
+		}
+		if showDetails {
+			m.LeaveType = leaveType.String
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"greentech-attendance/config"
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProjectHandler struct {
+	DB  *sql.DB
+	Cfg *config.Config
+}
+
+type ProjectRequest struct {
+	Code       string `json:"code" binding:"required"`
+	Name       string `json:"name" binding:"required"`
+	CostCenter string `json:"cost_center"`
+	Client     string `json:"client"`
+	Active     *bool  `json:"active"`
+}
+
+type AttendanceAllocationsRequest struct {
+	Allocations []models.AttendanceAllocation `json:"allocations" binding:"dive"`
+}
+
+// GetProjects 返回启用的项目；管理员传 include_inactive=true 时包括已停用的项目
+func (h *ProjectHandler) GetProjects(c *gin.Context) {
+	role, _ := c.Get("role")
+	query := `
+		SELECT id, code, name, COALESCE(cost_center, ''), COALESCE(client, ''), active, created_at, updated_at
+		FROM projects`
+	if !(role == "admin" && c.Query("include_inactive") == "true") {
+		query += " WHERE active"
+	}
+	rows, err := h.DB.Query(query + " ORDER BY code")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取项目列表失败"})
+		return
+	}
+	defer rows.Close()
+
+	projects := []models.Project{}
+	for rows.Next() {
+		var p models.Project
+		if err := rows.Scan(&p.ID, &p.Code, &p.Name, &p.CostCenter, &p.Client, &p.Active, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			continue
+		}
+		projects = append(projects, p)
+	}
+
+	c.JSON(http.StatusOK, projects)
+}
+
+func (h *ProjectHandler) CreateProject(c *gin.Context) {
+	var req ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	var id int
+	err := h.DB.QueryRow(`
+		INSERT INTO projects (code, name, cost_center, client, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, req.Code, req.Name, req.CostCenter, req.Client, active).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "项目编号已存在或创建失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "项目创建成功", "id": id})
+}
+
+func (h *ProjectHandler) UpdateProject(c *gin.Context) {
+	var req ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	result, err := h.DB.Exec(`
+		UPDATE projects
+		SET code = $1, name = $2, cost_center = $3, client = $4, active = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6
+	`, req.Code, req.Name, req.CostCenter, req.Client, active, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "项目编号已存在或更新失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "项目更新成功"})
+}
+
+// DeleteProject 删除未使用过的项目，已有工时记录的项目只能停用
+func (h *ProjectHandler) DeleteProject(c *gin.Context) {
+	id := c.Param("id")
+
+	var used bool
+	err := h.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM attendance_records WHERE project_id = $1)
+			OR EXISTS (SELECT 1 FROM attendance_allocations WHERE project_id = $1)
+	`, id).Scan(&used)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除项目失败"})
+		return
+	}
+	if used {
+		c.JSON(http.StatusConflict, gin.H{"error": "项目已有工时记录，只能停用"})
+		return
+	}
+
+	result, err := h.DB.Exec("DELETE FROM projects WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除项目失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+func loadAttendanceAllocations(db *sql.DB, recordID interface{}) ([]models.AttendanceAllocation, error) {
+	rows, err := db.Query(`
+		SELECT a.project_id, p.code, p.name, a.hours
+		FROM attendance_allocations a
+		JOIN projects p ON a.project_id = p.id
+		WHERE a.attendance_record_id = $1
+		ORDER BY p.code
+	`, recordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	allocations := []models.AttendanceAllocation{}
+	for rows.Next() {
+		var a models.AttendanceAllocation
+		if err := rows.Scan(&a.ProjectID, &a.ProjectCode, &a.ProjectName, &a.Hours); err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, a)
+	}
+	return allocations, rows.Err()
+}
+
+// GetAttendanceAllocations 返回考勤记录的项目工时拆分，本人和管理员可查看
+func (h *ProjectHandler) GetAttendanceAllocations(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	var ownerID int
+	var checkIn time.Time
+	var checkOut sql.NullTime
+	var projectID sql.NullInt64
+	err := h.DB.QueryRow(`
+		SELECT user_id, check_in_time, check_out_time, project_id FROM attendance_records WHERE id = $1
+	`, id).Scan(&ownerID, &checkIn, &checkOut, &projectID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "考勤记录不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取考勤记录失败"})
+		return
+	}
+	if ownerID != userID.(int) && role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看"})
+		return
+	}
+
+	allocations, err := loadAttendanceAllocations(h.DB, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取项目工时失败"})
+		return
+	}
+
+	var worked float64
+	if checkOut.Valid {
+		worked = round2(workedHours(h.Cfg, checkIn, checkOut.Time))
+	}
+	var defaultProject interface{}
+	if projectID.Valid {
+		defaultProject = projectID.Int64
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"worked_hours": worked,
+		"project_id":   defaultProject,
+		"allocations":  allocations,
+	})
+}
+
+// SetAttendanceAllocations 将签退后的工作时长拆分到多个项目，提交空列表即清除拆分；
+// 未拆分的剩余时长计入签到时选择的项目
+func (h *ProjectHandler) SetAttendanceAllocations(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	var req AttendanceAllocationsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var ownerID int
+	var checkIn time.Time
+	var checkOut sql.NullTime
+	err := h.DB.QueryRow(`
+		SELECT user_id, check_in_time, check_out_time FROM attendance_records WHERE id = $1
+	`, id).Scan(&ownerID, &checkIn, &checkOut)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "考勤记录不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取考勤记录失败"})
+		return
+	}
+	if ownerID != userID.(int) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作"})
+		return
+	}
+	if !checkOut.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "签退后才能分配项目工时"})
+		return
+	}
+	if !checkPayrollUnlocked(c, h.DB, checkIn, checkIn) || !checkTimesheetUnlocked(c, h.DB, userID, checkIn) {
+		return
+	}
+
+	worked := workedHours(h.Cfg, checkIn, checkOut.Time)
+	var total float64
+	seen := map[int]bool{}
+	for _, a := range req.Allocations {
+		if seen[a.ProjectID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "同一项目不能重复分配"})
+			return
+		}
+		seen[a.ProjectID] = true
+		total += a.Hours
+	}
+	if total > worked+0.01 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("项目工时合计不能超过当天工作时长%.2f小时", worked)})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM attendance_allocations WHERE attendance_record_id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存项目工时失败"})
+		return
+	}
+	for _, a := range req.Allocations {
+		result, err := tx.Exec(`
+			INSERT INTO attendance_allocations (attendance_record_id, project_id, hours)
+			SELECT $1, id, $3 FROM projects WHERE id = $2 AND active
+		`, id, a.ProjectID, a.Hours)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存项目工时失败"})
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "项目不存在或已停用"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "项目工时已保存"})
+}
+
+// computeProjectHours 按月汇总各项目的工时：有拆分的按拆分计入，剩余时长计入签到时选择的项目，
+// 都没有的计入未分配（ProjectID 为空）。departmentID 不为0时只统计该部门及其下级部门的员工
+func computeProjectHours(db *sql.DB, cfg *config.Config, start, end time.Time, departmentID int) ([]models.ProjectHours, error) {
+	allocations := map[int][]models.AttendanceAllocation{}
+	rows, err := db.Query(`
+		SELECT a.attendance_record_id, a.project_id, a.hours
+		FROM attendance_allocations a
+		JOIN attendance_records r ON a.attendance_record_id = r.id
+		WHERE DATE(r.check_in_time) BETWEEN $1 AND $2
+	`, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var recordID int
+		var a models.AttendanceAllocation
+		if err := rows.Scan(&recordID, &a.ProjectID, &a.Hours); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		allocations[recordID] = append(allocations[recordID], a)
+	}
+	rows.Close()
+
+	type key struct {
+		month   string
+		project int
+	}
+	hours := map[key]float64{}
+	employees := map[key]map[int]bool{}
+	add := func(k key, userID int, h float64) {
+		if h <= 0 {
+			return
+		}
+		hours[k] += h
+		if employees[k] == nil {
+			employees[k] = map[int]bool{}
+		}
+		employees[k][userID] = true
+	}
+
+	rows, err = db.Query(`
+		SELECT r.id, r.user_id, r.check_in_time, r.check_out_time, COALESCE(r.project_id, 0)
+		FROM attendance_records r
+		JOIN users u ON r.user_id = u.id
+		WHERE r.check_out_time IS NOT NULL AND DATE(r.check_in_time) BETWEEN $1 AND $2
+		  AND `+inDepartmentTree("$3")+`
+	`, start, end, departmentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var recordID, userID, projectID int
+		var checkIn, checkOut time.Time
+		if err := rows.Scan(&recordID, &userID, &checkIn, &checkOut, &projectID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		month := checkIn.Format("2006-01")
+		remaining := workedHours(cfg, checkIn, checkOut)
+		for _, a := range allocations[recordID] {
+			add(key{month, a.ProjectID}, userID, a.Hours)
+			remaining -= a.Hours
+		}
+		add(key{month, projectID}, userID, remaining)
+	}
+	rows.Close()
+
+	projects := map[int]models.Project{}
+	rows, err = db.Query("SELECT id, code, name, COALESCE(cost_center, ''), COALESCE(client, '') FROM projects")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p models.Project
+		if err := rows.Scan(&p.ID, &p.Code, &p.Name, &p.CostCenter, &p.Client); err != nil {
+			return nil, err
+		}
+		projects[p.ID] = p
+	}
+
+	report := []models.ProjectHours{}
+	for k, h := range hours {
+		item := models.ProjectHours{Month: k.month, Hours: round2(h), Employees: len(employees[k]), ProjectName: "未分配"}
+		if k.project != 0 {
+			id := k.project
+			p := projects[id]
+			item.ProjectID = &id
+			item.ProjectCode, item.ProjectName, item.CostCenter, item.Client = p.Code, p.Name, p.CostCenter, p.Client
+		}
+		report = append(report, item)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Month != report[j].Month {
+			return report[i].Month < report[j].Month
+		}
+		if (report[i].ProjectID == nil) != (report[j].ProjectID == nil) {
+			return report[j].ProjectID == nil
+		}
+		return report[i].ProjectCode < report[j].ProjectCode
+	})
+	return report, rows.Err()
+}
+
+// GetProjectHoursReport 按月统计各项目工时，from/to 为 YYYY-MM，默认当月；指定 format 时导出表格
+func (h *ProjectHandler) GetProjectHoursReport(c *gin.Context) {
+	thisMonth := time.Now().Format("2006-01")
+	from, err1 := time.Parse("2006-01", c.DefaultQuery("from", thisMonth))
+	to, err2 := time.Parse("2006-01", c.DefaultQuery("to", c.DefaultQuery("from", thisMonth)))
+	if err1 != nil || err2 != nil || to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "月份格式错误"})
+		return
+	}
+	departmentID, ok := departmentIDParam(c)
+	if !ok {
+		return
+	}
+
+	report, err := computeProjectHours(h.DB, h.Cfg, from, to.AddDate(0, 1, -1), departmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计项目工时失败"})
+		return
+	}
+
+	if c.Query("format") == "" {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	w := startExport(c, fmt.Sprintf("project_hours_%s_%s", from.Format("2006-01"), to.Format("2006-01")), "项目工时")
+	if w == nil {
+		return
+	}
+	w.WriteRow([]interface{}{"月份", "项目编号", "项目名称", "成本中心", "客户", "工时(小时)", "人数"})
+	for _, r := range report {
+		err := w.WriteRow([]interface{}{r.Month, r.ProjectCode, r.ProjectName, r.CostCenter, r.Client, r.Hours, r.Employees})
+		if err != nil {
+			log.Printf("export project hours failed: %v", err)
+			return
+		}
+	}
+	if err := w.Close(); err != nil {
+		log.Printf("export project hours failed: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateManagerRequest struct {
+	// 为空时清除直属上级
+	ManagerID *int `json:"manager_id"`
+}
+
+// managementChainSQL 从 $1 指定的用户沿直属上级向上查找，结果包括该用户本人。
+// 使用 UNION 去重，即使数据中存在环也能结束
+const managementChainSQL = `
+	WITH RECURSIVE chain AS (
+		SELECT id, manager_id FROM users WHERE id = $1
+		UNION
+		SELECT u.id, u.manager_id FROM users u JOIN chain ON u.id = chain.manager_id
+	)`
+
+// reportingLineLockKey 修改直属上级时持有的事务级咨询锁
+const reportingLineLockKey = 7301
+
+// inReportingLine 判断 managerID 是否为 userID 本人或其直接、间接上级
+func inReportingLine(db *sql.DB, managerID, userID interface{}) (bool, error) {
+	var ok bool
+	err := db.QueryRow(managementChainSQL+`
+		SELECT EXISTS (SELECT 1 FROM chain WHERE id = $2)
+	`, userID, managerID).Scan(&ok)
+	return ok, err
+}
+
+// UpdateManager 设置员工的直属上级，不能设为本人或本人的下属
+func (h *UserHandler) UpdateManager(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "用户ID格式错误"})
+		return
+	}
+	var req UpdateManagerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	// 汇报线的调整串行执行，避免两个并发修改各自通过检查后共同形成环
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", reportingLineLockKey); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查汇报关系失败"})
+		return
+	}
+
+	if req.ManagerID != nil {
+		// 新上级的汇报链上出现该员工即会形成环
+		var cyclic bool
+		err := tx.QueryRow(managementChainSQL+`
+			SELECT EXISTS (SELECT 1 FROM chain WHERE id = $2)
+		`, *req.ManagerID, id).Scan(&cyclic)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查汇报关系失败"})
+			return
+		}
+		if cyclic {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "直属上级不能是本人或本人的下属"})
+			return
+		}
+	}
+
+	result, err := tx.Exec(`
+		UPDATE users SET manager_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+	`, req.ManagerID, id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "直属上级不存在或更新失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
+}
+
+// GetReports 返回员工的直接和间接下属，传 direct=true 时只返回直接下属。
+// 管理员和HR可查看任何人，其他人只能查看本人或汇报线上的下属
+func (h *UserHandler) GetReports(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "用户ID格式错误"})
+		return
+	}
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	if role != "admin" && role != "hr" {
+		allowed, err := inReportingLine(h.DB, userID, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查汇报关系失败"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问"})
+			return
+		}
+	}
+
+	rows, err := h.DB.Query(`
+		WITH RECURSIVE reports AS (
+			SELECT id FROM users WHERE manager_id = $1
+			UNION
+			SELECT u.id FROM users u JOIN reports r ON u.manager_id = r.id
+		)
+		SELECT u.id, u.name, COALESCE(u.department, ''), COALESCE(u.position, ''), u.manager_id
+		FROM users u
+		JOIN reports r ON r.id = u.id
+		WHERE u.id <> $1 AND (NOT $2 OR u.manager_id = $1)
+		ORDER BY u.manager_id = $1 DESC, u.name
+	`, id, c.Query("direct") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取下属失败"})
+		return
+	}
+	defer rows.Close()
+
+	members := []models.OrgMember{}
+	for rows.Next() {
+		var m models.OrgMember
+		var managerID sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.Name, &m.Department, &m.Position, &managerID); err != nil {
+			continue
+		}
+		if managerID.Valid {
+			mid := int(managerID.Int64)
+			m.ManagerID = &mid
+			m.Direct = mid == id
+		}
+		members = append(members, m)
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// GetOrgChart 按汇报线返回组织架构树；传 root_id 时只返回该员工及其下属，
+// 否则以所有没有直属上级的员工为根
+func (h *UserHandler) GetOrgChart(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT id, name, COALESCE(department, ''), COALESCE(position, ''), manager_id
+		FROM users ORDER BY name
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取组织架构失败"})
+		return
+	}
+	defer rows.Close()
+
+	nodes := map[int]*models.OrgNode{}
+	order := []*models.OrgNode{}
+	for rows.Next() {
+		n := &models.OrgNode{Reports: []*models.OrgNode{}}
+		var managerID sql.NullInt64
+		if err := rows.Scan(&n.ID, &n.Name, &n.Department, &n.Position, &managerID); err != nil {
+			continue
+		}
+		if managerID.Valid {
+			mid := int(managerID.Int64)
+			n.ManagerID = &mid
+		}
+		nodes[n.ID] = n
+		order = append(order, n)
+	}
+
+	children := map[int][]*models.OrgNode{}
+	tops := []*models.OrgNode{}
+	for _, n := range order {
+		if n.ManagerID != nil {
+			if _, ok := nodes[*n.ManagerID]; ok && *n.ManagerID != n.ID {
+				children[*n.ManagerID] = append(children[*n.ManagerID], n)
+				continue
+			}
+		}
+		tops = append(tops, n)
+	}
+
+	// 逐层挂接下属并跳过已访问的节点，数据中存在环时也不会重复出现或无限嵌套
+	visited := map[int]bool{}
+	var attach func(n *models.OrgNode)
+	attach = func(n *models.OrgNode) {
+		visited[n.ID] = true
+		for _, r := range children[n.ID] {
+			if !visited[r.ID] {
+				n.Reports = append(n.Reports, r)
+				attach(r)
+			}
+		}
+	}
+
+	roots := []*models.OrgNode{}
+	if rootID := c.Query("root_id"); rootID != "" {
+		id, err := strconv.Atoi(rootID)
+		root, ok := nodes[id]
+		if err != nil || !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		attach(root)
+		roots = append(roots, root)
+	} else {
+		for _, n := range tops {
+			attach(n)
+			roots = append(roots, n)
+		}
+		// 环上的员工没有可达的根，以先出现的一人为根展示
+		for _, n := range order {
+			if !visited[n.ID] {
+				attach(n)
+				roots = append(roots, n)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, roots)
+}
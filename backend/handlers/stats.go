@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"greentech-attendance/config"
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StatsHandler struct {
+	DB  *sql.DB
+	Cfg *config.Config
+}
+
+// statsTrendDays 趋势统计覆盖的天数（含今天）
+const statsTrendDays = 30
+
+// lateAfter 返回班次开始时间 HH:MM，签到时间按分钟截断后晚于该时间即为迟到，与 isLateCheckIn 一致
+func lateAfter(cfg *config.Config) string {
+	start := parseClock(cfg.WorkStartTime, 9*60)
+	return fmt.Sprintf("%02d:%02d", start/60, start%60)
+}
+
+// GetOverview 返回今日出勤概况、待审批数量、近30天趋势和部门分布，全部由数据库聚合计算
+func (h *StatsHandler) GetOverview(c *gin.Context) {
+	today := time.Now().Format("2006-01-02")
+	late := lateAfter(h.Cfg)
+	overview := models.StatsOverview{Date: today}
+
+	err := h.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(DISTINCT user_id) FROM attendance_records WHERE DATE(check_in_time) = $1),
+			(SELECT COUNT(DISTINCT user_id) FROM attendance_records
+			 WHERE DATE(check_in_time) = $1 AND date_trunc('minute', check_in_time)::time > $2::time),
+			(SELECT COUNT(DISTINCT user_id) FROM leave_requests
+			 WHERE status IN ('approved', 'cancel_pending') AND $1 BETWEEN start_date AND end_date
+			   AND leave_type <> 'business_trip'),
+			(SELECT COUNT(DISTINCT user_id) FROM leave_requests
+			 WHERE status IN ('approved', 'cancel_pending') AND $1 BETWEEN start_date AND end_date
+			   AND leave_type = 'business_trip'),
+			(SELECT COUNT(*) FROM leave_requests WHERE status = 'pending'),
+			(SELECT COUNT(*) FROM leave_requests WHERE status = 'cancel_pending'),
+			(SELECT COUNT(*) FROM timesheets WHERE status = 'submitted')
+	`, today, late).Scan(
+		&overview.Headcount, &overview.CheckedIn, &overview.Late, &overview.OnLeave, &overview.OnTrip,
+		&overview.PendingApprovals.LeaveRequests, &overview.PendingApprovals.Cancellations,
+		&overview.PendingApprovals.Timesheets,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计数据失败"})
+		return
+	}
+
+	trend, err := h.dailyTrend(today, late)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计数据失败"})
+		return
+	}
+	overview.Trend = trend
+
+	departments, err := h.departmentBreakdown(today, late)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计数据失败"})
+		return
+	}
+	overview.Departments = departments
+
+	c.JSON(http.StatusOK, overview)
+}
+
+func (h *StatsHandler) dailyTrend(today, late string) ([]models.DailyStats, error) {
+	rows, err := h.DB.Query(`
+		WITH days AS (
+			SELECT d::date AS day
+			FROM generate_series($1::date - ($3 - 1), $1::date, INTERVAL '1 day') d
+		),
+		attendance AS (
+			SELECT DATE(check_in_time) AS day,
+				   COUNT(DISTINCT user_id) AS checked_in,
+				   COUNT(DISTINCT user_id) FILTER (
+					   WHERE date_trunc('minute', check_in_time)::time > $2::time
+				   ) AS late
+			FROM attendance_records
+			WHERE DATE(check_in_time) BETWEEN $1::date - ($3 - 1) AND $1::date
+			GROUP BY DATE(check_in_time)
+		),
+		leave AS (
+			SELECT days.day, COUNT(DISTINCT l.user_id) AS on_leave
+			FROM days
+			JOIN leave_requests l ON days.day BETWEEN l.start_date AND l.end_date
+			WHERE l.status IN ('approved', 'cancel_pending') AND l.leave_type <> 'business_trip'
+			GROUP BY days.day
+		)
+		SELECT days.day, COALESCE(a.checked_in, 0), COALESCE(a.late, 0), COALESCE(leave.on_leave, 0)
+		FROM days
+		LEFT JOIN attendance a ON a.day = days.day
+		LEFT JOIN leave ON leave.day = days.day
+		ORDER BY days.day
+	`, today, late, statsTrendDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trend := []models.DailyStats{}
+	for rows.Next() {
+		var s models.DailyStats
+		var day time.Time
+		if err := rows.Scan(&day, &s.CheckedIn, &s.Late, &s.OnLeave); err != nil {
+			return nil, err
+		}
+		s.Date = day.Format("2006-01-02")
+		trend = append(trend, s)
+	}
+	return trend, rows.Err()
+}
+
+func (h *StatsHandler) departmentBreakdown(today, late string) ([]models.DepartmentStats, error) {
+	rows, err := h.DB.Query(`
+		SELECT u.department_id, COALESCE(dp.name, u.department, ''),
+			   COUNT(*),
+			   COUNT(*) FILTER (WHERE a.user_id IS NOT NULL),
+			   COUNT(*) FILTER (WHERE date_trunc('minute', a.check_in_time)::time > $2::time),
+			   COUNT(*) FILTER (WHERE EXISTS (
+				   SELECT 1 FROM leave_requests l
+				   WHERE l.user_id = u.id AND l.status IN ('approved', 'cancel_pending')
+					 AND l.leave_type <> 'business_trip' AND $1 BETWEEN l.start_date AND l.end_date
+			   ))
+		FROM users u
+		LEFT JOIN (
+			SELECT user_id, MIN(check_in_time) AS check_in_time
+			FROM attendance_records
+			WHERE DATE(check_in_time) = $1
+			GROUP BY user_id
+		) a ON a.user_id = u.id
+		LEFT JOIN department_paths dp ON dp.id = u.department_id
+		GROUP BY u.department_id, dp.path, COALESCE(dp.name, u.department, '')
+		ORDER BY dp.path NULLS LAST, COALESCE(dp.name, u.department, '')
+	`, today, late)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	departments := []models.DepartmentStats{}
+	for rows.Next() {
+		var d models.DepartmentStats
+		var departmentID sql.NullInt64
+		if err := rows.Scan(&departmentID, &d.Department, &d.Headcount, &d.CheckedIn, &d.Late, &d.OnLeave); err != nil {
+			return nil, err
+		}
+		if departmentID.Valid {
+			id := int(departmentID.Int64)
+			d.DepartmentID = &id
+		}
+		departments = append(departments, d)
+	}
+	return departments, rows.Err()
+}
@@ -0,0 +1,623 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"time"
+
+	"greentech-attendance/config"
+	"greentech-attendance/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// 工时表状态：submitted 待审批；approved 已审批，期间内考勤只读；rejected 已驳回；reopened 已重新开放。
+// 驳回或重新开放后员工可重新提交，提交时重新生成每日快照
+type TimesheetHandler struct {
+	DB  *sql.DB
+	Cfg *config.Config
+}
+
+type SubmitTimesheetRequest struct {
+	PeriodType  string                       `json:"period_type" binding:"required,oneof=weekly monthly"`
+	StartDate   string                       `json:"start_date" binding:"required"`
+	Note        string                       `json:"note"`
+	Allocations []models.TimesheetAllocation `json:"allocations" binding:"dive"`
+}
+
+type ReopenTimesheetRequest struct {
+	Remark string `json:"remark"`
+}
+
+// timesheetApproverCondition 返回判断用户ap能否审批工时表的SQL条件：申请人所在部门的经理或直属上级，
+// 不能审批自己的工时表。调用方需提供别名 t(timesheets)、u(提交人users)、ap(审批人users)
+const timesheetApproverCondition = `ap.id <> t.user_id AND (
+	(ap.role = 'manager' AND ap.department_id = u.department_id) OR ap.id = u.manager_id
+)`
+
+// timesheetPeriod 按周期类型计算期间：周报从周一开始，月报从每月1日开始
+func timesheetPeriod(periodType, startDate string) (time.Time, time.Time, bool) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return start, start, false
+	}
+	if periodType == "weekly" {
+		return start, start.AddDate(0, 0, 6), start.Weekday() == time.Monday
+	}
+	return start, start.AddDate(0, 1, -1), start.Day() == 1
+}
+
+// buildTimesheetDays 从考勤和已批准的请假生成期间内的每日记录，请假天数按请假期间内不含节假日的工作日平均分摊；
+// 出差不计入请假，出差期间的工作日标记为出差并视同出勤
+func buildTimesheetDays(db *sql.DB, cfg *config.Config, userID interface{}, start, end time.Time) ([]models.TimesheetDay, error) {
+	// 节假日需覆盖与期间重叠的整段请假，分摊的分母才能与分配时一样排除节假日
+	var holidayStart, holidayEnd time.Time
+	err := db.QueryRow(`
+		SELECT LEAST(MIN(start_date), $2::date), GREATEST(MAX(end_date), $3::date) FROM leave_requests
+		WHERE user_id = $1 AND status IN ('approved', 'cancel_pending')
+		  AND start_date <= $3 AND end_date >= $2
+	`, userID, start, end).Scan(&holidayStart, &holidayEnd)
+	if err != nil {
+		return nil, err
+	}
+	holidays, err := holidaysInRange(db, holidayStart, holidayEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	days := []models.TimesheetDay{}
+	index := map[string]int{}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format("2006-01-02")
+		index[key] = len(days)
+		days = append(days, models.TimesheetDay{WorkDate: key})
+	}
+
+	rows, err := db.Query(`
+		SELECT check_in_time, check_out_time FROM attendance_records
+		WHERE user_id = $1 AND DATE(check_in_time) BETWEEN $2 AND $3
+		ORDER BY check_in_time
+	`, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var checkIn time.Time
+		var checkOut sql.NullTime
+		if err := rows.Scan(&checkIn, &checkOut); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		day := &days[index[checkIn.Format("2006-01-02")]]
+		day.CheckIn = &checkIn
+		if checkOut.Valid {
+			day.CheckOut = &checkOut.Time
+			day.WorkedHours = round2(workedHours(cfg, checkIn, checkOut.Time))
+		}
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT leave_type, start_date, end_date, days FROM leave_requests
+		WHERE user_id = $1 AND status IN ('approved', 'cancel_pending')
+		  AND start_date <= $3 AND end_date >= $2
+	`, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var leaveType string
+		var leaveStart, leaveEnd time.Time
+		var leaveDays float64
+		if err := rows.Scan(&leaveType, &leaveStart, &leaveEnd, &leaveDays); err != nil {
+			return nil, err
+		}
+		if leaveType == "business_trip" {
+			for d := leaveStart; !d.After(leaveEnd); d = d.AddDate(0, 0, 1) {
+				key := d.Format("2006-01-02")
+				if i, ok := index[key]; ok && isChargeableDay(d, holidays) {
+					days[i].OnTrip = true
+				}
+			}
+			continue
+		}
+		total := 0
+		for d := leaveStart; !d.After(leaveEnd); d = d.AddDate(0, 0, 1) {
+			if isChargeableDay(d, holidays) {
+				total++
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		for d := leaveStart; !d.After(leaveEnd); d = d.AddDate(0, 0, 1) {
+			key := d.Format("2006-01-02")
+			i, ok := index[key]
+			if !ok || !isChargeableDay(d, holidays) {
+				continue
+			}
+			days[i].LeaveDays = math.Round((days[i].LeaveDays+leaveDays/float64(total))*1000) / 1000
+		}
+	}
+	return days, rows.Err()
+}
+
+// SubmitTimesheet 提交周或月工时表，可附带按项目分配的工时
+func (h *TimesheetHandler) SubmitTimesheet(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req SubmitTimesheetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	start, end, ok := timesheetPeriod(req.PeriodType, req.StartDate)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "周工时表须从周一开始，月工时表须从每月1日开始"})
+		return
+	}
+	if start.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能提交未开始期间的工时表"})
+		return
+	}
+
+	var existingID int
+	var existingStatus string
+	err := h.DB.QueryRow(`
+		SELECT id, status FROM timesheets WHERE user_id = $1 AND start_date = $2 AND end_date = $3
+	`, userID, start, end).Scan(&existingID, &existingStatus)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交工时表失败"})
+		return
+	}
+	if err == nil && existingStatus != "rejected" && existingStatus != "reopened" {
+		c.JSON(http.StatusConflict, gin.H{"error": "该期间的工时表已提交", "timesheet_id": existingID})
+		return
+	}
+	if err == sql.ErrNoRows {
+		var overlapping int
+		err = h.DB.QueryRow(`
+			SELECT id FROM timesheets WHERE user_id = $1 AND start_date <= $3 AND end_date >= $2 LIMIT 1
+		`, userID, start, end).Scan(&overlapping)
+		if err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "与已有工时表期间重叠", "timesheet_id": overlapping})
+			return
+		}
+		if err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "提交工时表失败"})
+			return
+		}
+	}
+
+	days, err := buildTimesheetDays(h.DB, h.Cfg, userID, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成工时表失败"})
+		return
+	}
+	var worked, leave, allocated float64
+	tripDays := 0
+	for _, d := range days {
+		worked += d.WorkedHours
+		leave += d.LeaveDays
+		if d.OnTrip {
+			tripDays++
+		}
+	}
+	seen := map[int]bool{}
+	for _, a := range req.Allocations {
+		if seen[a.ProjectID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "同一项目不能重复分配"})
+			return
+		}
+		seen[a.ProjectID] = true
+		allocated += a.Hours
+	}
+	if allocated > worked+0.01 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "项目工时合计不能超过实际工作时长"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	timesheetID := existingID
+	if existingID == 0 {
+		err = tx.QueryRow(`
+			INSERT INTO timesheets (user_id, period_type, start_date, end_date, worked_hours, leave_days, trip_days, note)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id
+		`, userID, req.PeriodType, start, end, round2(worked), leave, tripDays, req.Note).Scan(&timesheetID)
+	} else {
+		_, err = tx.Exec(`
+			UPDATE timesheets
+			SET status = 'submitted', worked_hours = $1, leave_days = $2, trip_days = $3, note = $4,
+				approver_id = NULL, remark = NULL, submitted_at = CURRENT_TIMESTAMP, decided_at = NULL
+			WHERE id = $5
+		`, round2(worked), leave, tripDays, req.Note, existingID)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM timesheet_days WHERE timesheet_id = $1", existingID)
+		}
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM timesheet_allocations WHERE timesheet_id = $1", existingID)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交工时表失败"})
+		return
+	}
+
+	for _, d := range days {
+		_, err = tx.Exec(`
+			INSERT INTO timesheet_days (timesheet_id, work_date, check_in_time, check_out_time, worked_hours, leave_days, on_trip)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, timesheetID, d.WorkDate, d.CheckIn, d.CheckOut, d.WorkedHours, d.LeaveDays, d.OnTrip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "提交工时表失败"})
+			return
+		}
+	}
+	for _, a := range req.Allocations {
+		result, err := tx.Exec(`
+			INSERT INTO timesheet_allocations (timesheet_id, project_id, project, hours, note)
+			SELECT $1, id, code, $3, $4 FROM projects WHERE id = $2 AND active
+		`, timesheetID, a.ProjectID, a.Hours, a.Note)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "提交工时表失败"})
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "项目不存在或已停用"})
+			return
+		}
+	}
+	if err := recordTimesheetEvent(tx, timesheetID, "submitted", userID, req.Note); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交工时表失败"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "工时表已提交",
+		"timesheet_id": timesheetID,
+		"worked_hours": round2(worked),
+		"leave_days":   leave,
+		"trip_days":    tripDays,
+	})
+}
+
+func recordTimesheetEvent(tx *sql.Tx, timesheetID int, action string, actorID interface{}, remark string) error {
+	_, err := tx.Exec(`
+		INSERT INTO timesheet_events (timesheet_id, action, actor_id, remark)
+		VALUES ($1, $2, $3, $4)
+	`, timesheetID, action, actorID, remark)
+	return err
+}
+
+const timesheetColumns = `t.id, t.user_id, u.name, COALESCE(u.department, ''), t.period_type, t.start_date, t.end_date,
+	t.status, t.worked_hours, t.leave_days, t.trip_days, COALESCE(t.note, ''), t.approver_id, COALESCE(t.remark, ''),
+	t.submitted_at, t.decided_at`
+
+func scanTimesheet(row interface{ Scan(...interface{}) error }) (models.Timesheet, error) {
+	var t models.Timesheet
+	var startDate, endDate time.Time
+	var approverID sql.NullInt64
+	var decidedAt sql.NullTime
+	err := row.Scan(
+		&t.ID, &t.UserID, &t.UserName, &t.UserDepartment, &t.PeriodType, &startDate, &endDate,
+		&t.Status, &t.WorkedHours, &t.LeaveDays, &t.TripDays, &t.Note, &approverID, &t.Remark,
+		&t.SubmittedAt, &decidedAt,
+	)
+	if err != nil {
+		return t, err
+	}
+	t.StartDate = startDate.Format("2006-01-02")
+	t.EndDate = endDate.Format("2006-01-02")
+	if approverID.Valid {
+		id := int(approverID.Int64)
+		t.ApproverID = &id
+	}
+	if decidedAt.Valid {
+		t.DecidedAt = &decidedAt.Time
+	}
+	return t, nil
+}
+
+func (h *TimesheetHandler) listTimesheets(c *gin.Context, where string, args ...interface{}) {
+	rows, err := h.DB.Query(`
+		SELECT `+timesheetColumns+`
+		FROM timesheets t
+		JOIN users u ON t.user_id = u.id
+		WHERE `+where+`
+		ORDER BY t.start_date DESC, u.name
+	`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取工时表失败"})
+		return
+	}
+	defer rows.Close()
+
+	timesheets := []models.Timesheet{}
+	for rows.Next() {
+		t, err := scanTimesheet(rows)
+		if err != nil {
+			continue
+		}
+		timesheets = append(timesheets, t)
+	}
+
+	c.JSON(http.StatusOK, timesheets)
+}
+
+func (h *TimesheetHandler) GetMyTimesheets(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	h.listTimesheets(c, "t.user_id = $1", userID)
+}
+
+// GetPendingTimesheets 返回当前用户（含受委托代审的经理）可审批的工时表，管理员可见全部；不包括本人的工时表
+func (h *TimesheetHandler) GetPendingTimesheets(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+	if role == "admin" {
+		h.listTimesheets(c, "t.status = 'submitted' AND t.user_id <> $1", userID)
+		return
+	}
+
+	principals, err := approvalPrincipals(h.DB, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审批委托失败"})
+		return
+	}
+	h.listTimesheets(c, `t.status = 'submitted' AND t.user_id <> $2 AND EXISTS (
+		SELECT 1 FROM users ap WHERE ap.id = ANY($1) AND `+timesheetApproverCondition+`
+	)`, pq.Array(principals), userID)
+}
+
+// canApproveTimesheet 管理员、提交人部门经理及其受委托人可审批或重新开放工时表。
+// 任何人都不能审批本人的工时表，即使受委托代审
+func canApproveTimesheet(db *sql.DB, timesheetID interface{}, userID int, role interface{}) (bool, error) {
+	var ownerID int
+	err := db.QueryRow("SELECT user_id FROM timesheets WHERE id = $1", timesheetID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		// 交给调用方返回工时表不存在
+		return role == "admin", nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if ownerID == userID {
+		return false, nil
+	}
+	if role == "admin" {
+		return true, nil
+	}
+	principals, err := approvalPrincipals(db, userID)
+	if err != nil {
+		return false, err
+	}
+	var allowed bool
+	err = db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM timesheets t
+			JOIN users u ON t.user_id = u.id
+			JOIN users ap ON ap.id = ANY($2)
+			WHERE t.id = $1 AND `+timesheetApproverCondition+`
+		)
+	`, timesheetID, pq.Array(principals)).Scan(&allowed)
+	return allowed, err
+}
+
+// GetTimesheet 返回工时表详情，包括每日快照、项目工时和操作记录
+func (h *TimesheetHandler) GetTimesheet(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	t, err := scanTimesheet(h.DB.QueryRow(`
+		SELECT `+timesheetColumns+`
+		FROM timesheets t
+		JOIN users u ON t.user_id = u.id
+		WHERE t.id = $1
+	`, id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工时表不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取工时表失败"})
+		return
+	}
+	if t.UserID != userID.(int) {
+		allowed, err := canApproveTimesheet(h.DB, id, userID.(int), role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查权限失败"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该工时表"})
+			return
+		}
+	}
+
+	if err := h.loadTimesheetDetails(&t); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取工时表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+func (h *TimesheetHandler) loadTimesheetDetails(t *models.Timesheet) error {
+	rows, err := h.DB.Query(`
+		SELECT work_date, check_in_time, check_out_time, worked_hours, leave_days, on_trip
+		FROM timesheet_days WHERE timesheet_id = $1 ORDER BY work_date
+	`, t.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	t.Days = []models.TimesheetDay{}
+	for rows.Next() {
+		var d models.TimesheetDay
+		var workDate time.Time
+		var checkIn, checkOut sql.NullTime
+		if err := rows.Scan(&workDate, &checkIn, &checkOut, &d.WorkedHours, &d.LeaveDays, &d.OnTrip); err != nil {
+			return err
+		}
+		d.WorkDate = workDate.Format("2006-01-02")
+		if checkIn.Valid {
+			d.CheckIn = &checkIn.Time
+		}
+		if checkOut.Valid {
+			d.CheckOut = &checkOut.Time
+		}
+		t.Days = append(t.Days, d)
+	}
+
+	rows, err = h.DB.Query(`
+		SELECT COALESCE(a.project_id, 0), COALESCE(p.code, ''), COALESCE(p.name, a.project), a.hours, COALESCE(a.note, '')
+		FROM timesheet_allocations a
+		LEFT JOIN projects p ON a.project_id = p.id
+		WHERE a.timesheet_id = $1
+		ORDER BY a.id
+	`, t.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	t.Allocations = []models.TimesheetAllocation{}
+	for rows.Next() {
+		var a models.TimesheetAllocation
+		if err := rows.Scan(&a.ProjectID, &a.ProjectCode, &a.ProjectName, &a.Hours, &a.Note); err != nil {
+			return err
+		}
+		t.Allocations = append(t.Allocations, a)
+	}
+
+	rows, err = h.DB.Query(`
+		SELECT e.action, e.actor_id, COALESCE(u.name, ''), COALESCE(e.remark, ''), e.created_at
+		FROM timesheet_events e
+		LEFT JOIN users u ON e.actor_id = u.id
+		WHERE e.timesheet_id = $1
+		ORDER BY e.created_at, e.id
+	`, t.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	t.History = []models.TimesheetEvent{}
+	for rows.Next() {
+		var e models.TimesheetEvent
+		var actorID sql.NullInt64
+		if err := rows.Scan(&e.Action, &actorID, &e.ActorName, &e.Remark, &e.CreatedAt); err != nil {
+			return err
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			e.ActorID = &id
+		}
+		t.History = append(t.History, e)
+	}
+	return rows.Err()
+}
+
+// ApproveTimesheet 审批或驳回已提交的工时表
+func (h *TimesheetHandler) ApproveTimesheet(c *gin.Context) {
+	var req ApproveLeaveRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	h.transitionTimesheet(c, "submitted", req.Status, req.Remark)
+}
+
+// ReopenTimesheet 重新开放已审批的工时表，期间内考勤恢复可修改，员工需重新提交
+func (h *TimesheetHandler) ReopenTimesheet(c *gin.Context) {
+	var req ReopenTimesheetRequest
+	c.ShouldBindJSON(&req)
+	h.transitionTimesheet(c, "approved", "reopened", req.Remark)
+}
+
+func (h *TimesheetHandler) transitionTimesheet(c *gin.Context, from, to, remark string) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	allowed, err := canApproveTimesheet(h.DB, id, userID.(int), role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查审批权限失败"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权审批该工时表"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	var timesheetID int
+	err = tx.QueryRow(`
+		UPDATE timesheets
+		SET status = $1, approver_id = $2, remark = $3, decided_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND status = $5
+		RETURNING id
+	`, to, userID, remark, id, from).Scan(&timesheetID)
+	if err == sql.ErrNoRows {
+		if from == "approved" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "只能重新开放已审批的工时表"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该工时表已被处理"})
+		}
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新工时表失败"})
+		return
+	}
+	if err := recordTimesheetEvent(tx, timesheetID, to, userID, remark); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新工时表失败"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "工时表已更新", "status": to})
+}
+
+// checkTimesheetUnlocked 日期落在用户已审批的工时表期间时返回错误响应，返回 false 表示调用方应终止处理
+func checkTimesheetUnlocked(c *gin.Context, db *sql.DB, userID interface{}, day time.Time) bool {
+	var locked bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM timesheets
+			WHERE user_id = $1 AND status = 'approved' AND $2 BETWEEN start_date AND end_date
+		)
+	`, userID, day.Format("2006-01-02")).Scan(&locked)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查工时表失败"})
+		return false
+	}
+	if locked {
+		c.JSON(http.StatusConflict, gin.H{"error": "该期间的工时表已审批，考勤记录不能修改"})
+		return false
+	}
+	return true
+}
@@ -7,8 +7,10 @@ import (
 	"time"
 
 	"greentech-attendance/models"
+	"greentech-attendance/webhook"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -17,27 +19,35 @@ type UserHandler struct {
 }
 
 type CreateUserRequest struct {
-	Username   string `json:"username" binding:"required"`
-	Password   string `json:"password" binding:"required,min=6"`
-	Name       string `json:"name" binding:"required"`
-	Email      string `json:"email"`
-	Phone      string `json:"phone"`
-	Role       string `json:"role" binding:"required,oneof=admin manager employee"`
-	Department string `json:"department"`
-	Position   string `json:"position"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Role     string `json:"role" binding:"required,oneof=admin manager hr employee"`
+	// 优先使用 department_id；只传 department 名称时按名称匹配部门，不存在则创建
+	Department   string `json:"department"`
+	DepartmentID *int   `json:"department_id"`
+	Position     string `json:"position"`
+}
+
+// UpdateAttendanceModesRequest 设置员工允许使用的考勤方式，至少保留一种
+type UpdateAttendanceModesRequest struct {
+	Modes []string `json:"modes" binding:"required,min=1,dive,oneof=office remote field"`
 }
 
 type UpdateUserRequest struct {
-	Name       string `json:"name"`
-	Email      string `json:"email"`
-	Phone      string `json:"phone"`
-	Department string `json:"department"`
-	Position   string `json:"position"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone"`
+	Department   string `json:"department"`
+	DepartmentID *int   `json:"department_id"`
+	Position     string `json:"position"`
 }
 
 func (h *UserHandler) GetUsers(c *gin.Context) {
 	rows, err := h.DB.Query(`
-		SELECT id, username, name, email, phone, role, department, position, created_at
+		SELECT id, username, name, email, phone, role, department, department_id, manager_id, position, attendance_modes, created_at
 		FROM users ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -50,13 +60,22 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 	for rows.Next() {
 		var user models.User
 		var email, phone, department, position sql.NullString
+		var departmentID, managerID sql.NullInt64
 		err := rows.Scan(
 			&user.ID, &user.Username, &user.Name, &email, &phone,
-			&user.Role, &department, &position, &user.CreatedAt,
+			&user.Role, &department, &departmentID, &managerID, &position, pq.Array(&user.AttendanceModes), &user.CreatedAt,
 		)
 		if err != nil {
 			continue
 		}
+		if departmentID.Valid {
+			id := int(departmentID.Int64)
+			user.DepartmentID = &id
+		}
+		if managerID.Valid {
+			id := int(managerID.Int64)
+			user.ManagerID = &id
+		}
 		user.Email = email.String
 		user.Phone = phone.String
 		user.Department = department.String
@@ -72,19 +91,28 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	role, _ := c.Get("role")
 
+	// 直接和间接上级也可以查看下属的信息
 	if role != "admin" && strconv.Itoa(userID.(int)) != id {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问"})
-		return
+		allowed, err := inReportingLine(h.DB, userID, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问"})
+			return
+		}
 	}
 
 	var user models.User
 	var email, phone, department, position sql.NullString
+	var departmentID, managerID sql.NullInt64
 	err := h.DB.QueryRow(`
-		SELECT id, username, name, email, phone, role, department, position, created_at
+		SELECT id, username, name, email, phone, role, department, department_id, manager_id, position, attendance_modes, created_at
 		FROM users WHERE id = $1
 	`, id).Scan(
 		&user.ID, &user.Username, &user.Name, &email, &phone,
-		&user.Role, &department, &position, &user.CreatedAt,
+		&user.Role, &department, &departmentID, &managerID, &position, pq.Array(&user.AttendanceModes), &user.CreatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -100,6 +128,14 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 	user.Phone = phone.String
 	user.Department = department.String
 	user.Position = position.String
+	if departmentID.Valid {
+		did := int(departmentID.Int64)
+		user.DepartmentID = &did
+	}
+	if managerID.Valid {
+		mid := int(managerID.Int64)
+		user.ManagerID = &mid
+	}
 
 	c.JSON(http.StatusOK, user)
 }
@@ -117,13 +153,31 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	departmentID, department, err := resolveDepartment(tx, req.DepartmentID, req.Department)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部门不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取部门失败"})
+		return
+	}
+	req.Department = department
+
 	var userID int
-	err = h.DB.QueryRow(`
-		INSERT INTO users (username, password, name, email, phone, role, department, position)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	err = tx.QueryRow(`
+		INSERT INTO users (username, password, name, email, phone, role, department, department_id, position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id
 	`, req.Username, string(hashedPassword), req.Name, req.Email, req.Phone,
-		req.Role, req.Department, req.Position).Scan(&userID)
+		req.Role, req.Department, departmentID, req.Position).Scan(&userID)
 
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "用户名已存在或创建失败"})
@@ -131,18 +185,43 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	}
 
 	currentYear := time.Now().Year()
-	_, err = h.DB.Exec(`
+	_, err = tx.Exec(`
 		INSERT INTO leave_balances (user_id, year, annual_leave, sick_leave, personal_leave)
 		VALUES ($1, $2, 10, 10, 5)
 	`, userID, currentYear)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建假期余额失败"})
+		return
+	}
+
+	err = webhook.Enqueue(tx, webhook.EventUserCreated, gin.H{
+		"id":            userID,
+		"username":      req.Username,
+		"name":          req.Name,
+		"email":         req.Email,
+		"role":          req.Role,
+		"department":    req.Department,
+		"department_id": departmentID,
+		"position":      req.Position,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"id":         userID,
-		"username":   req.Username,
-		"name":       req.Name,
-		"role":       req.Role,
-		"department": req.Department,
-		"position":   req.Position,
+		"id":            userID,
+		"username":      req.Username,
+		"name":          req.Name,
+		"role":          req.Role,
+		"department":    req.Department,
+		"department_id": departmentID,
+		"position":      req.Position,
 	})
 }
 
@@ -161,26 +240,94 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
 		return
 	}
+	// 只有传了部门时才修改所属部门，且只有管理员可以修改
+	changeDepartment := req.DepartmentID != nil || req.Department != ""
+	if changeDepartment && role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有管理员可以修改所属部门"})
+		return
+	}
 
-	_, err := h.DB.Exec(`
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启事务失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
 		UPDATE users 
 		SET name = COALESCE(NULLIF($1, ''), name),
 			email = COALESCE(NULLIF($2, ''), email),
 			phone = COALESCE(NULLIF($3, ''), phone),
-			department = COALESCE(NULLIF($4, ''), department),
-			position = COALESCE(NULLIF($5, ''), position),
+			position = COALESCE(NULLIF($4, ''), position),
 			updated_at = CURRENT_TIMESTAMP
-		WHERE id = $6
-	`, req.Name, req.Email, req.Phone, req.Department, req.Position, id)
+		WHERE id = $5
+	`, req.Name, req.Email, req.Phone, req.Position, id)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户失败"})
 		return
 	}
 
+	if changeDepartment {
+		departmentID, department, err := resolveDepartment(tx, req.DepartmentID, req.Department)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "部门不存在"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取部门失败"})
+			return
+		}
+		_, err = tx.Exec("UPDATE users SET department = $1, department_id = $2 WHERE id = $3", department, departmentID, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户失败"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
 }
 
+// UpdateAttendanceModes 管理员设置员工允许的考勤方式（office、remote、field）
+func (h *UserHandler) UpdateAttendanceModes(c *gin.Context) {
+	var req UpdateAttendanceModesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	modes := []string{}
+	seen := map[string]bool{}
+	for _, mode := range req.Modes {
+		if !seen[mode] {
+			seen[mode] = true
+			modes = append(modes, mode)
+		}
+	}
+
+	result, err := h.DB.Exec(`
+		UPDATE users SET attendance_modes = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+	`, pq.Array(modes), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新考勤方式失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "attendance_modes": modes})
+}
+
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	id := c.Param("id")
 
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+
+	"greentech-attendance/models"
+	"greentech-attendance/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type WebhookHandler struct {
+	DB *sql.DB
+}
+
+type WebhookEndpointRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Events      []string `json:"events" binding:"required,min=1"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+func validWebhookEndpoint(req WebhookEndpointRequest) bool {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	known := map[string]bool{}
+	for _, event := range webhook.Events {
+		known[event] = true
+	}
+	for _, event := range req.Events {
+		if !known[event] {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *WebhookHandler) GetWebhookEvents(c *gin.Context) {
+	c.JSON(http.StatusOK, webhook.Events)
+}
+
+func (h *WebhookHandler) GetWebhooks(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT id, url, events, COALESCE(description, ''), active, created_at, updated_at
+		FROM webhook_endpoints
+		ORDER BY id
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取Webhook失败"})
+		return
+	}
+	defer rows.Close()
+
+	endpoints := []models.WebhookEndpoint{}
+	for rows.Next() {
+		var e models.WebhookEndpoint
+		err := rows.Scan(&e.ID, &e.URL, pq.Array(&e.Events), &e.Description, &e.Active, &e.CreatedAt, &e.UpdatedAt)
+		if err != nil {
+			continue
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	c.JSON(http.StatusOK, endpoints)
+}
+
+// CreateWebhook 注册Webhook端点，签名密钥只在创建时返回一次
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req WebhookEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validWebhookEndpoint(req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成签名密钥失败"})
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	endpoint := models.WebhookEndpoint{
+		URL:         req.URL,
+		Secret:      secret,
+		Events:      req.Events,
+		Description: req.Description,
+		Active:      active,
+	}
+	err = h.DB.QueryRow(`
+		INSERT INTO webhook_endpoints (url, secret, events, description, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`, req.URL, secret, pq.Array(req.Events), req.Description, active).Scan(
+		&endpoint.ID, &endpoint.CreatedAt, &endpoint.UpdatedAt,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建Webhook失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, endpoint)
+}
+
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	var req WebhookEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validWebhookEndpoint(req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	result, err := h.DB.Exec(`
+		UPDATE webhook_endpoints
+		SET url = $1, events = $2, description = $3, active = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+	`, req.URL, pq.Array(req.Events), req.Description, active, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新Webhook失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook更新成功"})
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	result, err := h.DB.Exec("DELETE FROM webhook_endpoints WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除Webhook失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// GetWebhookDeliveries 投递日志，可按端点和状态筛选
+func (h *WebhookHandler) GetWebhookDeliveries(c *gin.Context) {
+	endpointID := c.Query("endpoint_id")
+	status := c.Query("status")
+
+	rows, err := h.DB.Query(`
+		SELECT w.id, w.endpoint_id, e.url, w.event_id, o.event_type, w.status, w.attempts,
+			   w.next_attempt_at, w.last_status_code, COALESCE(w.last_response, ''),
+			   COALESCE(w.last_error, ''), w.delivered_at, w.created_at
+		FROM webhook_deliveries w
+		JOIN webhook_endpoints e ON e.id = w.endpoint_id
+		JOIN outbox_events o ON o.id = w.event_id
+		WHERE ($1 = '' OR w.endpoint_id::text = $1) AND ($2 = '' OR w.status = $2)
+		ORDER BY w.id DESC
+		LIMIT 200
+	`, endpointID, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取投递记录失败"})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var nextAttemptAt, deliveredAt sql.NullTime
+		var statusCode sql.NullInt64
+		err := rows.Scan(
+			&d.ID, &d.EndpointID, &d.EndpointURL, &d.EventID, &d.EventType, &d.Status, &d.Attempts,
+			&nextAttemptAt, &statusCode, &d.LastResponse, &d.LastError, &deliveredAt, &d.CreatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		if nextAttemptAt.Valid && d.Status == "pending" {
+			d.NextAttemptAt = &nextAttemptAt.Time
+		}
+		if statusCode.Valid {
+			code := int(statusCode.Int64)
+			d.LastStatusCode = &code
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RedeliverWebhook 手动重新投递，重置重试次数后由后台立即发送。
+// 只能重新投递已成功、已失败或租约已过期的待投递记录，正在发送或等待重试的记录不能重置
+func (h *WebhookHandler) RedeliverWebhook(c *gin.Context) {
+	result, err := h.DB.Exec(`
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		  AND (status IN ('success', 'failed') OR (status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP))
+	`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重新投递失败"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		var exists bool
+		if err := h.DB.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE id = $1)
+		`, c.Param("id")).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "重新投递失败"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "投递记录不存在"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "该记录正在投递或等待重试，请稍后再试"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已加入重新投递队列"})
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -33,6 +34,48 @@ func GenerateToken(userID int, username, role string, cfg *config.Config) (strin
 	return token.SignedString([]byte(cfg.JWTSecret))
 }
 
+// streamAudience 标记只能用于建立在岗状态推送连接的短期令牌
+const streamAudience = "presence_stream"
+
+// StreamTokenTTL 推送令牌的有效期，只需覆盖建立连接的时间，连接建立后不再校验
+const StreamTokenTTL = time.Minute
+
+// GenerateStreamToken 签发只能通过 access_token 查询参数打开推送连接的短期令牌。
+// 浏览器的 EventSource 无法设置请求头，用它代替把登录令牌放进链接
+func GenerateStreamToken(userID int, username, role string, cfg *config.Config) (string, error) {
+	claims := Claims{
+		UserID:   userID,
+		Username: username,
+		Role:     role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{streamAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(StreamTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(cfg.JWTSecret))
+}
+
+// parseToken 校验令牌签名和有效期，返回其中的声明
+func parseToken(tokenString string, cfg *config.Config) (*Claims, bool) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(cfg.JWTSecret), nil
+	})
+	return claims, err == nil && token.Valid
+}
+
+func isStreamToken(claims *Claims) bool {
+	for _, aud := range claims.Audience {
+		if aud == streamAudience {
+			return true
+		}
+	}
+	return false
+}
+
 func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -49,14 +92,9 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(cfg.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
+		// 推送令牌只能用于推送连接
+		claims, ok := parseToken(parts[1], cfg)
+		if !ok || isStreamToken(claims) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的认证令牌"})
 			c.Abort()
 			return
@@ -80,3 +118,38 @@ func AdminMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// StreamAuthMiddleware 校验 access_token 查询参数中的推送令牌，登录令牌不能通过查询参数传递
+func StreamAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := parseToken(c.Query("access_token"), cfg)
+		if !ok || !isStreamToken(claims) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的推送令牌"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("role", claims.Role)
+		c.Next()
+	}
+}
+
+// AccessLogger 按 gin 默认格式记录访问日志，路径记录匹配的路由模式（如 /api/ics/:token），
+// 不记录实际路径参数和查询参数，避免链接中的订阅令牌、推送令牌写入日志
+func AccessLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" {
+			// 未匹配任何路由，不含令牌
+			path = c.Request.URL.Path
+		}
+		fmt.Fprintf(gin.DefaultWriter, "[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			start.Format("2006/01/02 - 15:04:05"), c.Writer.Status(), time.Since(start), c.ClientIP(),
+			c.Request.Method, path, c.Errors.ByType(gin.ErrorTypePrivate).String())
+	}
+}
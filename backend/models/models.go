@@ -3,17 +3,23 @@ package models
 import "time"
 
 type User struct {
-	ID         int       `json:"id"`
-	Username   string    `json:"username"`
-	Password   string    `json:"-"`
-	Name       string    `json:"name"`
-	Email      string    `json:"email"`
-	Phone      string    `json:"phone"`
-	Role       string    `json:"role"`
-	Department string    `json:"department"`
-	Position   string    `json:"position"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID         int    `json:"id"`
+	Username   string `json:"username"`
+	Password   string `json:"-"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	Phone      string `json:"phone"`
+	Role       string `json:"role"`
+	Department string `json:"department"`
+	// 所属部门ID，department 为该部门的名称
+	DepartmentID *int `json:"department_id"`
+	// 直属上级的用户ID
+	ManagerID *int   `json:"manager_id"`
+	Position  string `json:"position"`
+	// 允许使用的考勤方式：office、remote、field
+	AttendanceModes []string  `json:"attendance_modes"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 type AttendanceRecord struct {
@@ -25,33 +31,433 @@ type AttendanceRecord struct {
 	CheckInLocation  string     `json:"check_in_location"`
 	CheckOutLocation string     `json:"check_out_location"`
 	Status           string     `json:"status"`
+	Mode             string     `json:"mode"`
+	ProjectID        *int       `json:"project_id,omitempty"`
+	DeviceFlagged    bool       `json:"device_flagged,omitempty"`
+	FieldVisits      int        `json:"field_visits,omitempty"`
 	CreatedAt        time.Time  `json:"created_at"`
 }
 
+// LeaveTypeNames 各语言下请假类型的显示名称，键与申请请假时可选的类型一致
+var LeaveTypeNames = map[string]map[string]string{
+	"zh": {"annual": "年假", "sick": "病假", "personal": "事假", "other": "其他假", "business_trip": "出差"},
+	"en": {"annual": "annual leave", "sick": "sick leave", "personal": "personal leave", "other": "leave", "business_trip": "business trip"},
+}
+
 type LeaveRequest struct {
-	ID           int       `json:"id"`
-	UserID       int       `json:"user_id"`
-	UserName     string    `json:"user_name,omitempty"`
-	LeaveType    string    `json:"leave_type"`
-	StartDate    string    `json:"start_date"`
-	EndDate      string    `json:"end_date"`
-	Days         float64   `json:"days"`
-	Reason       string    `json:"reason"`
-	Status       string    `json:"status"`
-	ApproverID   *int      `json:"approver_id"`
-	ApproverName string    `json:"approver_name,omitempty"`
-	Remark       string    `json:"remark"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            int           `json:"id"`
+	UserID        int           `json:"user_id"`
+	UserName      string        `json:"user_name,omitempty"`
+	LeaveType     string        `json:"leave_type"`
+	Destination   string        `json:"destination,omitempty"`
+	StartDate     string        `json:"start_date"`
+	EndDate       string        `json:"end_date"`
+	StartTime     *time.Time    `json:"start_time,omitempty"`
+	EndTime       *time.Time    `json:"end_time,omitempty"`
+	Days          float64       `json:"days"`
+	Hours         float64       `json:"hours,omitempty"`
+	Reason        string        `json:"reason"`
+	Status        string        `json:"status"`
+	ApproverID    *int          `json:"approver_id"`
+	ApproverName  string        `json:"approver_name,omitempty"`
+	Remark        string        `json:"remark"`
+	CancelEndDate string        `json:"cancel_end_date,omitempty"`
+	CancelDays    float64       `json:"cancel_days,omitempty"`
+	CancelReason  string        `json:"cancel_reason,omitempty"`
+	CancelRemark  string        `json:"cancel_remark,omitempty"`
+	CurrentStep   int           `json:"current_step"`
+	Charges       []LeaveCharge `json:"charges,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// LeaveCharge 请假在某一余额年度扣减的天数，跨年申请会拆分为多条
+type LeaveCharge struct {
+	Year int     `json:"year"`
+	Days float64 `json:"days"`
 }
 
 type LeaveBalance struct {
+	ID                 int       `json:"id"`
+	UserID             int       `json:"user_id"`
+	Year               int       `json:"year"`
+	AnnualLeave        float64   `json:"annual_leave"`
+	SickLeave          float64   `json:"sick_leave"`
+	PersonalLeave      float64   `json:"personal_leave"`
+	HoursPerDay        float64   `json:"hours_per_day"`
+	AnnualLeaveHours   float64   `json:"annual_leave_hours"`
+	SickLeaveHours     float64   `json:"sick_leave_hours"`
+	PersonalLeaveHours float64   `json:"personal_leave_hours"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+type ApprovalRule struct {
+	ID        int                `json:"id"`
+	Name      string             `json:"name"`
+	LeaveType string             `json:"leave_type"`
+	MinDays   *float64           `json:"min_days"`
+	MaxDays   *float64           `json:"max_days"`
+	Priority  int                `json:"priority"`
+	Steps     []ApprovalRuleStep `json:"steps"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+type ApprovalRuleStep struct {
+	StepOrder     int    `json:"step_order"`
+	ApproverType  string `json:"approver_type"`
+	ApproverValue string `json:"approver_value"`
+}
+
+type LeaveApprovalStep struct {
+	ID            int        `json:"id"`
+	StepOrder     int        `json:"step_order"`
+	ApproverType  string     `json:"approver_type"`
+	ApproverValue string     `json:"approver_value"`
+	Status        string     `json:"status"`
+	ActedBy       *int       `json:"acted_by"`
+	ActedByName   string     `json:"acted_by_name,omitempty"`
+	OnBehalfOf    *int       `json:"on_behalf_of"`
+	OnBehalfName  string     `json:"on_behalf_of_name,omitempty"`
+	ActedAt       *time.Time `json:"acted_at"`
+	Remark        string     `json:"remark"`
+}
+
+type ApprovalDelegation struct {
 	ID            int       `json:"id"`
-	UserID        int       `json:"user_id"`
-	Year          int       `json:"year"`
-	AnnualLeave   float64   `json:"annual_leave"`
-	SickLeave     float64   `json:"sick_leave"`
-	PersonalLeave float64   `json:"personal_leave"`
+	DelegatorID   int       `json:"delegator_id"`
+	DelegatorName string    `json:"delegator_name,omitempty"`
+	DelegateID    int       `json:"delegate_id"`
+	DelegateName  string    `json:"delegate_name,omitempty"`
+	StartDate     string    `json:"start_date"`
+	EndDate       string    `json:"end_date"`
+	Reason        string    `json:"reason"`
+	Active        bool      `json:"active"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type LeaveAttachment struct {
+	ID             int       `json:"id"`
+	LeaveRequestID int       `json:"leave_request_id"`
+	FileName       string    `json:"file_name"`
+	ContentType    string    `json:"content_type"`
+	Size           int64     `json:"size"`
+	UploadedBy     int       `json:"uploaded_by"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type LeaveTypePolicy struct {
+	LeaveType              string   `json:"leave_type"`
+	AttachmentRequiredDays *float64 `json:"attachment_required_days"`
+	MinUnitHours           *float64 `json:"min_unit_hours"`
+}
+
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+type CalendarFeed struct {
+	FeedType  string    `json:"feed_type"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Notification struct {
+	ID        int        `json:"id"`
+	Event     string     `json:"event"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	Link      string     `json:"link"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type NotificationPreference struct {
+	Event string `json:"event"`
+	InApp bool   `json:"in_app"`
+	Email bool   `json:"email"`
+}
+
+type WebhookEndpoint struct {
+	ID          int       `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int        `json:"id"`
+	EndpointID     int        `json:"endpoint_id"`
+	EndpointURL    string     `json:"endpoint_url"`
+	EventID        int        `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int       `json:"last_status_code,omitempty"`
+	LastResponse   string     `json:"last_response,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type ChatChannel struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	DepartmentID  *int      `json:"department_id"`
+	Department    string    `json:"department"`
+	Provider      string    `json:"provider"`
+	WebhookURL    string    `json:"webhook_url"`
+	HasSecret     bool      `json:"has_secret"`
+	ApproversOnly bool      `json:"approvers_only"`
+	Events        []string  `json:"events"`
+	DigestTime    string    `json:"digest_time"`
+	Active        bool      `json:"active"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
+
+type PayrollPeriod struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	StartDate string     `json:"start_date"`
+	EndDate   string     `json:"end_date"`
+	Status    string     `json:"status"`
+	LockedAt  *time.Time `json:"locked_at,omitempty"`
+	LockedBy  *int       `json:"locked_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type PayrollColumn struct {
+	Header string `json:"header"`
+	Field  string `json:"field"`
+}
+
+type PayrollTemplate struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Columns   []PayrollColumn `json:"columns"`
+	IsDefault bool            `json:"is_default"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type PayrollSummary struct {
+	UserID            int     `json:"user_id"`
+	Username          string  `json:"username"`
+	Name              string  `json:"name"`
+	Department        string  `json:"department"`
+	Position          string  `json:"position"`
+	WorkingDays       int     `json:"working_days"`
+	DaysAttended      int     `json:"days_attended"`
+	AbsentDays        float64 `json:"absent_days"`
+	UnpaidLeaveDays   float64 `json:"unpaid_leave_days"`
+	PaidLeaveDays     float64 `json:"paid_leave_days"`
+	AnnualLeaveDays   float64 `json:"annual_leave_days"`
+	SickLeaveDays     float64 `json:"sick_leave_days"`
+	PersonalLeaveDays float64 `json:"personal_leave_days"`
+	OtherLeaveDays    float64 `json:"other_leave_days"`
+	LateCount         int     `json:"late_count"`
+	OvertimeHours     float64 `json:"overtime_hours"`
+	OfficeDays        int     `json:"office_days"`
+	RemoteDays        int     `json:"remote_days"`
+	FieldDays         int     `json:"field_days"`
+	// 出差的工作日，计入实际出勤天数
+	TripDays int `json:"trip_days"`
+}
+
+type Timesheet struct {
+	ID             int                   `json:"id"`
+	UserID         int                   `json:"user_id"`
+	UserName       string                `json:"user_name,omitempty"`
+	UserDepartment string                `json:"user_department,omitempty"`
+	PeriodType     string                `json:"period_type"`
+	StartDate      string                `json:"start_date"`
+	EndDate        string                `json:"end_date"`
+	Status         string                `json:"status"`
+	WorkedHours    float64               `json:"worked_hours"`
+	LeaveDays      float64               `json:"leave_days"`
+	TripDays       int                   `json:"trip_days"`
+	Note           string                `json:"note,omitempty"`
+	ApproverID     *int                  `json:"approver_id,omitempty"`
+	Remark         string                `json:"remark,omitempty"`
+	SubmittedAt    time.Time             `json:"submitted_at"`
+	DecidedAt      *time.Time            `json:"decided_at,omitempty"`
+	Days           []TimesheetDay        `json:"days,omitempty"`
+	Allocations    []TimesheetAllocation `json:"allocations,omitempty"`
+	History        []TimesheetEvent      `json:"history,omitempty"`
+}
+
+// TimesheetDay 提交时从考勤和请假记录生成的每日快照
+type TimesheetDay struct {
+	WorkDate    string     `json:"work_date"`
+	CheckIn     *time.Time `json:"check_in,omitempty"`
+	CheckOut    *time.Time `json:"check_out,omitempty"`
+	WorkedHours float64    `json:"worked_hours"`
+	LeaveDays   float64    `json:"leave_days"`
+	// OnTrip 当天出差，视同出勤
+	OnTrip bool `json:"on_trip,omitempty"`
+}
+
+// TimesheetAllocation 工时表中按项目分配的工时，项目取自项目表；ProjectID 为 0 表示改用项目表之前提交的记录
+type TimesheetAllocation struct {
+	ProjectID   int     `json:"project_id" binding:"required"`
+	ProjectCode string  `json:"project_code,omitempty"`
+	ProjectName string  `json:"project_name,omitempty"`
+	Hours       float64 `json:"hours" binding:"required,gt=0"`
+	Note        string  `json:"note"`
+}
+
+type TimesheetEvent struct {
+	Action    string    `json:"action"`
+	ActorID   *int      `json:"actor_id,omitempty"`
+	ActorName string    `json:"actor_name,omitempty"`
+	Remark    string    `json:"remark,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Project struct {
+	ID         int       `json:"id"`
+	Code       string    `json:"code"`
+	Name       string    `json:"name"`
+	CostCenter string    `json:"cost_center"`
+	Client     string    `json:"client"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type AttendanceAllocation struct {
+	ProjectID   int     `json:"project_id" binding:"required"`
+	ProjectCode string  `json:"project_code,omitempty"`
+	ProjectName string  `json:"project_name,omitempty"`
+	Hours       float64 `json:"hours" binding:"required,gt=0"`
+}
+
+// ProjectHours 按月、项目汇总的工时
+type ProjectHours struct {
+	Month       string  `json:"month"`
+	ProjectID   *int    `json:"project_id"`
+	ProjectCode string  `json:"project_code"`
+	ProjectName string  `json:"project_name"`
+	CostCenter  string  `json:"cost_center"`
+	Client      string  `json:"client"`
+	Hours       float64 `json:"hours"`
+	Employees   int     `json:"employees"`
+}
+
+type StatsOverview struct {
+	Date             string            `json:"date"`
+	Headcount        int               `json:"headcount"`
+	CheckedIn        int               `json:"checked_in"`
+	Late             int               `json:"late"`
+	OnLeave          int               `json:"on_leave"`
+	OnTrip           int               `json:"on_trip"`
+	PendingApprovals PendingApprovals  `json:"pending_approvals"`
+	Trend            []DailyStats      `json:"trend"`
+	Departments      []DepartmentStats `json:"departments"`
+}
+
+type PendingApprovals struct {
+	LeaveRequests int `json:"leave_requests"`
+	Cancellations int `json:"cancellations"`
+	Timesheets    int `json:"timesheets"`
+}
+
+type DailyStats struct {
+	Date      string `json:"date"`
+	CheckedIn int    `json:"checked_in"`
+	Late      int    `json:"late"`
+	OnLeave   int    `json:"on_leave"`
+}
+
+type DepartmentStats struct {
+	DepartmentID *int   `json:"department_id"`
+	Department   string `json:"department"`
+	Headcount    int    `json:"headcount"`
+	CheckedIn    int    `json:"checked_in"`
+	Late         int    `json:"late"`
+	OnLeave      int    `json:"on_leave"`
+}
+
+type AttendanceAnomaly struct {
+	ID                 int                    `json:"id"`
+	Kind               string                 `json:"kind"`
+	Severity           string                 `json:"severity"`
+	UserID             int                    `json:"user_id"`
+	UserName           string                 `json:"user_name"`
+	UserDepartment     string                 `json:"user_department"`
+	AttendanceRecordID int                    `json:"attendance_record_id"`
+	RelatedUserID      *int                   `json:"related_user_id,omitempty"`
+	RelatedUserName    string                 `json:"related_user_name,omitempty"`
+	RelatedRecordID    *int                   `json:"related_record_id,omitempty"`
+	DetectedOn         string                 `json:"detected_on"`
+	Details            map[string]interface{} `json:"details"`
+	Status             string                 `json:"status"`
+	ReviewedBy         *int                   `json:"reviewed_by,omitempty"`
+	ReviewedAt         *time.Time             `json:"reviewed_at,omitempty"`
+	ReviewNote         string                 `json:"review_note,omitempty"`
+	CreatedAt          time.Time              `json:"created_at"`
+}
+
+type UserDevice struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	UserName    string     `json:"user_name,omitempty"`
+	Fingerprint string     `json:"fingerprint"`
+	Name        string     `json:"name"`
+	UserAgent   string     `json:"user_agent"`
+	Status      string     `json:"status"`
+	FirstSeenAt time.Time  `json:"first_seen_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ReviewedBy  *int       `json:"reviewed_by,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+}
+
+type FieldVisit struct {
+	ID                 int       `json:"id"`
+	AttendanceRecordID int       `json:"attendance_record_id"`
+	Location           string    `json:"location"`
+	Customer           string    `json:"customer"`
+	Note               string    `json:"note"`
+	VisitedAt          time.Time `json:"visited_at"`
+}
+
+// Department 部门，ParentID 为空表示顶级部门；Path 为从顶级部门到本部门的名称
+type Department struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	ParentID    *int      `json:"parent_id"`
+	HeadUserID  *int      `json:"head_user_id"`
+	HeadName    string    `json:"head_name,omitempty"`
+	Path        []string  `json:"path"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// OrgMember 汇报线上的员工，Direct 表示直接下属
+type OrgMember struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Department string `json:"department"`
+	Position   string `json:"position"`
+	ManagerID  *int   `json:"manager_id"`
+	Direct     bool   `json:"direct"`
+}
+
+// OrgNode 组织架构图的节点，Reports 为直接下属
+type OrgNode struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Department string     `json:"department"`
+	Position   string     `json:"position"`
+	ManagerID  *int       `json:"manager_id"`
+	Reports    []*OrgNode `json:"reports"`
+}
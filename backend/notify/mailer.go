@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// noopMailer 未配置SMTP时使用，只记录日志
+type noopMailer struct{}
+
+func (noopMailer) Send(to, subject, body string) error {
+	log.Printf("SMTP not configured, skip email to %s: %s", to, subject)
+	return nil
+}
+
+// SMTPMailer 通过SMTP发送纯文本邮件，未配置用户名时不做认证（如本地 Mailpit）
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	headers := []string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + mime.BEncoding.Encode("UTF-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Transfer-Encoding: base64",
+	}
+	msg := strings.Join(headers, "\r\n") + "\r\n\r\n" + wrapBase64(base64.StdEncoding.EncodeToString([]byte(body)))
+
+	addr := fmt.Sprintf("%s:%s", m.Host, m.Port)
+	return smtp.SendMail(addr, auth, m.From, []string{to}, []byte(msg))
+}
+
+// wrapBase64 按每行76个字符换行
+func wrapBase64(s string) string {
+	var b strings.Builder
+	for len(s) > 76 {
+		b.WriteString(s[:76])
+		b.WriteString("\r\n")
+		s = s[76:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
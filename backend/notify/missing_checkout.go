@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// StartMissingCheckOutJob 每天在 at（HH:MM）检查前一天签到后未签退的记录并提醒本人
+func (n *Notifier) StartMissingCheckOutJob(at string) {
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		log.Printf("invalid missing check-out time %q, job disabled", at)
+		return
+	}
+
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			if err := n.NotifyMissingCheckOuts(next.AddDate(0, 0, -1)); err != nil {
+				log.Printf("missing check-out job failed: %v", err)
+			}
+		}
+	}()
+}
+
+// NotifyMissingCheckOuts 提醒指定日期签到后未签退的用户，同一条记录只提醒一次
+func (n *Notifier) NotifyMissingCheckOuts(day time.Time) error {
+	rows, err := n.DB.Query(`
+		SELECT id, user_id, check_in_time FROM attendance_records
+		WHERE DATE(check_in_time) = $1 AND check_out_time IS NULL
+	`, day.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type record struct {
+		id, userID  int
+		checkInTime time.Time
+	}
+	records := []record{}
+	for rows.Next() {
+		var r record
+		if err := rows.Scan(&r.id, &r.userID, &r.checkInTime); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		n.Notify([]int{r.userID}, Message{
+			Event: EventMissingCheckOut,
+			Ref:   fmt.Sprintf("attendance:%d", r.id),
+			Link:  "/dashboard/attendance",
+			Once:  true,
+			Data: map[string]string{
+				"date":          r.checkInTime.Format("2006-01-02"),
+				"check_in_time": r.checkInTime.Format("15:04"),
+			},
+		})
+	}
+	return nil
+}
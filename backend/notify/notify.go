@@ -0,0 +1,146 @@
+package notify
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"greentech-attendance/config"
+)
+
+// 通知事件类型
+const (
+	EventLeaveSubmitted      = "leave_submitted"
+	EventLeaveApproved       = "leave_approved"
+	EventLeaveRejected       = "leave_rejected"
+	EventCorrectionRequested = "correction_requested"
+	EventMissingCheckOut     = "missing_check_out"
+	EventCheckInReminder     = "check_in_reminder"
+	EventCheckOutReminder    = "check_out_reminder"
+)
+
+// Events 所有可配置偏好的事件，按展示顺序排列
+var Events = []string{
+	EventLeaveSubmitted,
+	EventLeaveApproved,
+	EventLeaveRejected,
+	EventCorrectionRequested,
+	EventMissingCheckOut,
+	EventCheckInReminder,
+	EventCheckOutReminder,
+}
+
+// Message 一次通知的内容，标题和正文按接收人的语言从模板渲染
+type Message struct {
+	Event string
+	// Ref 关联对象，如 leave:12、attendance:34
+	Ref string
+	// Link 前端页面的相对路径
+	Link string
+	Data map[string]string
+	// Once 为 true 时同一用户同一事件同一关联对象只通知一次
+	Once bool
+}
+
+// Notifier 将事件写入站内信箱并按用户偏好发送邮件
+type Notifier struct {
+	DB      *sql.DB
+	Mailer  Mailer
+	BaseURL string
+}
+
+func New(db *sql.DB, cfg *config.Config) *Notifier {
+	var mailer Mailer = noopMailer{}
+	if cfg.SMTPHost != "" {
+		mailer = &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		}
+	}
+	return &Notifier{DB: db, Mailer: mailer, BaseURL: strings.TrimRight(cfg.AppBaseURL, "/")}
+}
+
+// Notify 向一组用户发送通知。通知失败只记录日志，不影响调用方的业务流程
+func (n *Notifier) Notify(userIDs []int, msg Message) {
+	if n == nil {
+		return
+	}
+	seen := map[int]bool{}
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		if err := n.notifyUser(userID, msg); err != nil {
+			log.Printf("notify user %d (%s) failed: %v", userID, msg.Event, err)
+		}
+	}
+}
+
+func (n *Notifier) notifyUser(userID int, msg Message) error {
+	var email, language sql.NullString
+	var inApp, byEmail sql.NullBool
+	err := n.DB.QueryRow(`
+		SELECT u.email, u.language, p.in_app, p.email
+		FROM users u
+		LEFT JOIN notification_preferences p ON p.user_id = u.id AND p.event = $2
+		WHERE u.id = $1
+	`, userID, msg.Event).Scan(&email, &language, &inApp, &byEmail)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// 未设置偏好时默认站内信和邮件都发送
+	sendInApp := !inApp.Valid || inApp.Bool
+	sendEmail := (!byEmail.Valid || byEmail.Bool) && email.String != ""
+	if !sendInApp && !sendEmail {
+		return nil
+	}
+
+	if msg.Once {
+		var exists bool
+		err := n.DB.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM notifications WHERE user_id = $1 AND event = $2 AND ref = $3)
+		`, userID, msg.Event, msg.Ref).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+	}
+
+	title, body, err := render(msg.Event, language.String, msg.Data)
+	if err != nil {
+		return err
+	}
+
+	if sendInApp || msg.Once {
+		// Once 的通知即使关闭了站内信也要落库，用于去重
+		_, err = n.DB.Exec(`
+			INSERT INTO notifications (user_id, event, title, body, link, ref, read_at)
+			VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $7 THEN NULL ELSE CURRENT_TIMESTAMP END)
+		`, userID, msg.Event, title, body, msg.Link, msg.Ref, sendInApp)
+		if err != nil {
+			return err
+		}
+	}
+
+	if sendEmail {
+		if msg.Link != "" {
+			body += "\n\n" + n.BaseURL + msg.Link
+		}
+		go func(to string) {
+			if err := n.Mailer.Send(to, title, body); err != nil {
+				log.Printf("send notification email to %s failed: %v", to, err)
+			}
+		}(email.String)
+	}
+	return nil
+}
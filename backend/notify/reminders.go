@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"log"
+	"time"
+
+	"greentech-attendance/config"
+)
+
+// Reminders 在上班后提醒未签到、下班后提醒未签退的员工。
+// 周末和节假日不提醒，请假当天不提醒签到；员工可在通知设置中关闭这两类提醒
+type Reminders struct {
+	Notifier        *Notifier
+	WorkStart       string
+	WorkEnd         string
+	CheckInMinutes  int
+	CheckOutMinutes int
+}
+
+func NewReminders(n *Notifier, cfg *config.Config) *Reminders {
+	return &Reminders{
+		Notifier:        n,
+		WorkStart:       cfg.WorkStartTime,
+		WorkEnd:         cfg.WorkEndTime,
+		CheckInMinutes:  cfg.CheckInReminderMinutes,
+		CheckOutMinutes: cfg.CheckOutReminderMinutes,
+	}
+}
+
+// Start 每分钟检查一次是否到了提醒时间，每种提醒每天只执行一次
+func (r *Reminders) Start() {
+	start, err1 := time.Parse("15:04", r.WorkStart)
+	end, err2 := time.Parse("15:04", r.WorkEnd)
+	if err1 != nil || err2 != nil {
+		log.Printf("invalid work time %q-%q, reminders disabled", r.WorkStart, r.WorkEnd)
+		return
+	}
+
+	go func() {
+		var checkInDone, checkOutDone string
+		for {
+			now := time.Now()
+			today := now.Format("2006-01-02")
+			at := func(clock time.Time, minutes int) time.Time {
+				return time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location()).
+					Add(time.Duration(minutes) * time.Minute)
+			}
+
+			if r.CheckInMinutes > 0 && checkInDone != today && !now.Before(at(start, r.CheckInMinutes)) {
+				checkInDone = today
+				if err := r.RemindCheckIn(now); err != nil {
+					log.Printf("check-in reminder failed: %v", err)
+				}
+			}
+			if r.CheckOutMinutes > 0 && checkOutDone != today && !now.Before(at(end, r.CheckOutMinutes)) {
+				checkOutDone = today
+				if err := r.RemindCheckOut(now); err != nil {
+					log.Printf("check-out reminder failed: %v", err)
+				}
+			}
+
+			time.Sleep(time.Until(now.Truncate(time.Minute).Add(time.Minute)))
+		}
+	}()
+}
+
+func (r *Reminders) isWorkday(day time.Time) (bool, error) {
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		return false, nil
+	}
+	var holiday bool
+	err := r.Notifier.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM holidays WHERE date = $1)
+	`, day.Format("2006-01-02")).Scan(&holiday)
+	return !holiday, err
+}
+
+// RemindCheckIn 提醒当天没有签到记录、也没有已批准请假的员工。
+// 按小时请假只有覆盖上班时间时才不提醒，下午请假的员工上午仍需签到
+func (r *Reminders) RemindCheckIn(day time.Time) error {
+	workday, err := r.isWorkday(day)
+	if err != nil || !workday {
+		return err
+	}
+
+	date := day.Format("2006-01-02")
+	userIDs, err := r.queryUserIDs(`
+		SELECT u.id FROM users u
+		WHERE NOT EXISTS (
+			SELECT 1 FROM attendance_records a WHERE a.user_id = u.id AND DATE(a.check_in_time) = $1
+		) AND NOT EXISTS (
+			SELECT 1 FROM leave_requests l
+			WHERE l.user_id = u.id AND l.status IN ('approved', 'cancel_pending')
+			  AND $1::date BETWEEN l.start_date AND l.end_date
+			  AND (l.start_time IS NULL OR ($1::date + $2::time) >= l.start_time AND ($1::date + $2::time) < l.end_time)
+		)
+	`, date, r.WorkStart)
+	if err != nil {
+		return err
+	}
+
+	r.Notifier.Notify(userIDs, Message{
+		Event: EventCheckInReminder,
+		Ref:   "check-in:" + date,
+		Link:  "/dashboard/attendance",
+		Once:  true,
+		Data:  map[string]string{"date": date, "work_start": r.WorkStart},
+	})
+	return nil
+}
+
+// RemindCheckOut 提醒当天已签到但还没有签退的员工
+func (r *Reminders) RemindCheckOut(day time.Time) error {
+	workday, err := r.isWorkday(day)
+	if err != nil || !workday {
+		return err
+	}
+
+	date := day.Format("2006-01-02")
+	userIDs, err := r.queryUserIDs(`
+		SELECT DISTINCT user_id FROM attendance_records
+		WHERE DATE(check_in_time) = $1 AND check_out_time IS NULL
+	`, date)
+	if err != nil {
+		return err
+	}
+
+	r.Notifier.Notify(userIDs, Message{
+		Event: EventCheckOutReminder,
+		Ref:   "check-out:" + date,
+		Link:  "/dashboard/attendance",
+		Once:  true,
+		Data:  map[string]string{"date": date, "work_end": r.WorkEnd},
+	})
+	return nil
+}
+
+func (r *Reminders) queryUserIDs(query string, args ...interface{}) ([]int, error) {
+	rows, err := r.Notifier.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"greentech-attendance/models"
+)
+
+type messageTemplate struct {
+	Title string
+	Body  string
+}
+
+// templates 各事件的中英文模板，变量来自 Message.Data
+var templates = map[string]map[string]messageTemplate{
+	EventLeaveSubmitted: {
+		"zh": {
+			Title: "待审批：{{.applicant}}的{{.leave_type}}申请",
+			Body:  "{{.applicant}}申请{{.leave_type}}，{{.start_date}} 至 {{.end_date}}，共{{.days}}天，等待您审批。\n原因：{{.reason}}",
+		},
+		"en": {
+			Title: "Approval needed: {{.leave_type}} request from {{.applicant}}",
+			Body:  "{{.applicant}} requested {{.leave_type}} from {{.start_date}} to {{.end_date}} ({{.days}} days) and is waiting for your approval.\nReason: {{.reason}}",
+		},
+	},
+	EventLeaveApproved: {
+		"zh": {
+			Title: "您的{{.leave_type}}申请已批准",
+			Body:  "您 {{.start_date}} 至 {{.end_date}} 的{{.leave_type}}申请已由{{.approver}}批准。{{if .remark}}\n备注：{{.remark}}{{end}}",
+		},
+		"en": {
+			Title: "Your {{.leave_type}} request was approved",
+			Body:  "Your {{.leave_type}} request from {{.start_date}} to {{.end_date}} was approved by {{.approver}}.{{if .remark}}\nRemark: {{.remark}}{{end}}",
+		},
+	},
+	EventLeaveRejected: {
+		"zh": {
+			Title: "您的{{.leave_type}}申请被驳回",
+			Body:  "您 {{.start_date}} 至 {{.end_date}} 的{{.leave_type}}申请已被{{.approver}}驳回。{{if .remark}}\n备注：{{.remark}}{{end}}",
+		},
+		"en": {
+			Title: "Your {{.leave_type}} request was rejected",
+			Body:  "Your {{.leave_type}} request from {{.start_date}} to {{.end_date}} was rejected by {{.approver}}.{{if .remark}}\nRemark: {{.remark}}{{end}}",
+		},
+	},
+	EventCorrectionRequested: {
+		"zh": {
+			Title: "请核对{{.date}}的考勤记录",
+			Body:  "{{.requester}}请您核对并更正{{.date}}的考勤记录。{{if .reason}}\n说明：{{.reason}}{{end}}",
+		},
+		"en": {
+			Title: "Please review your attendance on {{.date}}",
+			Body:  "{{.requester}} asked you to review and correct your attendance record on {{.date}}.{{if .reason}}\nNote: {{.reason}}{{end}}",
+		},
+	},
+	EventMissingCheckOut: {
+		"zh": {
+			Title: "{{.date}}未签退",
+			Body:  "您{{.date}} {{.check_in_time}} 签到后没有签退记录，请及时补充。",
+		},
+		"en": {
+			Title: "Missing check-out on {{.date}}",
+			Body:  "You checked in at {{.check_in_time}} on {{.date}} but there is no check-out. Please complete your record.",
+		},
+	},
+	EventCheckInReminder: {
+		"zh": {
+			Title: "您今天还没有签到",
+			Body:  "上班时间 {{.work_start}} 已过，系统未查到您{{.date}}的签到记录，请及时签到。",
+		},
+		"en": {
+			Title: "You haven't checked in today",
+			Body:  "Work started at {{.work_start}} but there is no check-in for {{.date}}. Please check in.",
+		},
+	},
+	EventCheckOutReminder: {
+		"zh": {
+			Title: "别忘了签退",
+			Body:  "下班时间 {{.work_end}} 已过，您{{.date}}还没有签退。",
+		},
+		"en": {
+			Title: "Don't forget to check out",
+			Body:  "Work ended at {{.work_end}} and you haven't checked out for {{.date}} yet.",
+		},
+	},
+}
+
+// render 按语言渲染通知标题和正文，不支持的语言使用中文
+func render(event, language string, data map[string]string) (string, string, error) {
+	byLang, ok := templates[event]
+	if !ok {
+		return "", "", fmt.Errorf("unknown notification event: %s", event)
+	}
+	tmpl, ok := byLang[language]
+	if !ok {
+		language = "zh"
+		tmpl = byLang[language]
+	}
+
+	vars := map[string]string{}
+	for k, v := range data {
+		vars[k] = v
+	}
+	if name, ok := models.LeaveTypeNames[language][vars["leave_type"]]; ok {
+		vars["leave_type"] = name
+	}
+
+	title, err := execute(tmpl.Title, vars)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := execute(tmpl.Body, vars)
+	if err != nil {
+		return "", "", err
+	}
+	return title, body, nil
+}
+
+func execute(text string, vars map[string]string) (string, error) {
+	t, err := template.New("").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,88 @@
+// Package presence 提供进程内的考勤与请假状态事件总线，供实时在岗看板订阅
+package presence
+
+import (
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	EventCheckIn     = "check_in"
+	EventCheckOut    = "check_out"
+	EventLeaveStatus = "leave_status"
+)
+
+// Event 在岗状态变化。请假事件的 Status 为请假申请的新状态
+type Event struct {
+	Type       string    `json:"type"`
+	UserID     int       `json:"user_id"`
+	UserName   string    `json:"user_name"`
+	Department string    `json:"department"`
+	Status     string    `json:"status,omitempty"`
+	RequestID  int       `json:"request_id,omitempty"`
+	LeaveType  string    `json:"leave_type,omitempty"`
+	StartDate  string    `json:"start_date,omitempty"`
+	EndDate    string    `json:"end_date,omitempty"`
+	Time       time.Time `json:"time"`
+	// Departments 用户所属部门及其全部上级部门的ID，用于按部门子树过滤
+	Departments []int `json:"-"`
+}
+
+// InDepartment 判断事件用户是否属于指定部门或其下级部门
+func (e Event) InDepartment(departmentID int) bool {
+	for _, id := range e.Departments {
+		if id == departmentID {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriberBuffer 每个订阅者的缓冲事件数，缓冲满时丢弃新事件，避免慢客户端阻塞发布方
+const subscriberBuffer = 64
+
+// Bus 单进程内的广播总线，多实例部署时每个实例只能看到本实例处理的事件
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[chan Event]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[chan Event]struct{}{}}
+}
+
+// Subscribe 订阅全部事件，调用返回的函数取消订阅
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Publish 向所有订阅者广播事件，不会阻塞；Bus 为 nil 时不做任何事
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
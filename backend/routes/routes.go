@@ -2,10 +2,16 @@ package routes
 
 import (
 	"database/sql"
+	"greentech-attendance/anomaly"
+	"greentech-attendance/chatbot"
 	"greentech-attendance/config"
 	"greentech-attendance/database"
 	"greentech-attendance/handlers"
 	"greentech-attendance/middleware"
+	"greentech-attendance/notify"
+	"greentech-attendance/presence"
+	"greentech-attendance/storage"
+	"greentech-attendance/webhook"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,32 +20,150 @@ func SetupRoutes(router *gin.Engine, db *sql.DB, cfg *config.Config) {
 	if err := database.InitDatabase(db); err != nil {
 		panic(err)
 	}
+	notifier := notify.New(db, cfg)
+	notifier.StartMissingCheckOutJob(cfg.MissingCheckOutTime)
+	notify.NewReminders(notifier, cfg).Start()
+	webhook.NewDispatcher(db).Start()
+	chatBot := chatbot.New(db, cfg)
+	chatBot.StartDigestJob()
+	presenceBus := presence.NewBus()
+	detector := anomaly.New(db, cfg)
+	detector.StartNightlyScan(cfg.AnomalyScanTime)
+
 	authHandler := &handlers.AuthHandler{DB: db, Cfg: cfg}
 	userHandler := &handlers.UserHandler{DB: db}
-	attendanceHandler := &handlers.AttendanceHandler{DB: db}
-	leaveHandler := &handlers.LeaveHandler{DB: db}
+	attendanceHandler := &handlers.AttendanceHandler{DB: db, Cfg: cfg, Notifier: notifier, Presence: presenceBus}
+	leaveHandler := &handlers.LeaveHandler{DB: db, Cfg: cfg, Notifier: notifier, ChatBot: chatBot, Presence: presenceBus}
+	approvalRuleHandler := &handlers.ApprovalRuleHandler{DB: db}
+	delegationHandler := &handlers.DelegationHandler{DB: db}
+	attachmentHandler := &handlers.AttachmentHandler{DB: db, Storage: storage.New(cfg), Cfg: cfg}
+	holidayHandler := &handlers.HolidayHandler{DB: db}
+	calendarHandler := &handlers.CalendarHandler{DB: db}
+	calendarFeedHandler := &handlers.CalendarFeedHandler{DB: db}
+	notificationHandler := &handlers.NotificationHandler{DB: db}
+	webhookHandler := &handlers.WebhookHandler{DB: db}
+	chatChannelHandler := &handlers.ChatChannelHandler{DB: db, Bot: chatBot}
+	payrollHandler := &handlers.PayrollHandler{DB: db, Cfg: cfg}
+	timesheetHandler := &handlers.TimesheetHandler{DB: db, Cfg: cfg}
+	projectHandler := &handlers.ProjectHandler{DB: db, Cfg: cfg}
+	statsHandler := &handlers.StatsHandler{DB: db, Cfg: cfg}
+	presenceHandler := &handlers.PresenceHandler{DB: db, Cfg: cfg, Bus: presenceBus}
+	anomalyHandler := &handlers.AnomalyHandler{DB: db, Detector: detector}
+	deviceHandler := &handlers.DeviceHandler{DB: db}
+	departmentHandler := &handlers.DepartmentHandler{DB: db}
 	api := router.Group("/api")
 	api.POST("/auth/login", authHandler.Login)
+	api.GET("/ics/:token", calendarFeedHandler.ServeFeed)
+	api.GET("/presence/stream", middleware.StreamAuthMiddleware(cfg), presenceHandler.Stream)
 	auth := api.Group("")
 	auth.Use(middleware.AuthMiddleware(cfg))
 	auth.POST("/auth/change-password", authHandler.ChangePassword)
 	auth.GET("/users/:id", userHandler.GetUser)
 	auth.PUT("/users/:id", userHandler.UpdateUser)
+	auth.GET("/users/:id/reports", userHandler.GetReports)
+	auth.GET("/org-chart", userHandler.GetOrgChart)
+	auth.POST("/presence/stream-token", presenceHandler.StreamToken)
 	auth.POST("/attendance/check-in", attendanceHandler.CheckIn)
 	auth.POST("/attendance/check-out", attendanceHandler.CheckOut)
 	auth.GET("/attendance/my", attendanceHandler.GetMyAttendance)
 	auth.GET("/attendance/today", attendanceHandler.GetTodayStatus)
+	auth.POST("/attendance/field-visits", attendanceHandler.CreateFieldVisit)
+	auth.GET("/attendance/:id/field-visits", attendanceHandler.GetFieldVisits)
+	auth.GET("/attendance/:id/allocations", projectHandler.GetAttendanceAllocations)
+	auth.PUT("/attendance/:id/allocations", projectHandler.SetAttendanceAllocations)
+	auth.GET("/projects", projectHandler.GetProjects)
+	auth.GET("/departments", departmentHandler.GetDepartments)
+	auth.GET("/devices/my", deviceHandler.GetMyDevices)
 	auth.POST("/leave-requests", leaveHandler.CreateLeaveRequest)
 	auth.GET("/leave-requests/my", leaveHandler.GetMyLeaveRequests)
+	auth.POST("/leave-requests/:id/withdraw", leaveHandler.WithdrawLeaveRequest)
+	auth.POST("/leave-requests/:id/cancel", leaveHandler.RequestLeaveCancellation)
+	auth.GET("/leave-requests/pending-approval", leaveHandler.GetPendingApprovals)
+	auth.GET("/leave-requests/:id/approvals", leaveHandler.GetLeaveApprovalSteps)
+	auth.PUT("/leave-requests/:id/approve", leaveHandler.ApproveLeaveRequest)
+	auth.PUT("/leave-requests/:id/cancel/approve", leaveHandler.ApproveLeaveCancellation)
+	auth.POST("/leave-requests/:id/attachments", attachmentHandler.UploadAttachment)
+	auth.GET("/leave-requests/:id/attachments", attachmentHandler.GetAttachments)
+	auth.GET("/leave-attachments/:id", attachmentHandler.DownloadAttachment)
+	auth.DELETE("/leave-attachments/:id", attachmentHandler.DeleteAttachment)
+	auth.GET("/leave-type-policies", leaveHandler.GetLeaveTypePolicies)
 	auth.GET("/leave-balances/my", leaveHandler.GetLeaveBalance)
+	auth.GET("/holidays", holidayHandler.GetHolidays)
+	auth.GET("/calendar/team", calendarHandler.GetTeamCalendar)
+	auth.GET("/calendar-feeds", calendarFeedHandler.GetMyFeeds)
+	auth.POST("/calendar-feeds/:type/token", calendarFeedHandler.RegenerateFeedToken)
+	auth.DELETE("/calendar-feeds/:type", calendarFeedHandler.RevokeFeedToken)
+	auth.GET("/notifications", notificationHandler.GetNotifications)
+	auth.PUT("/notifications/read-all", notificationHandler.MarkAllNotificationsRead)
+	auth.PUT("/notifications/:id/read", notificationHandler.MarkNotificationRead)
+	auth.GET("/notification-preferences", notificationHandler.GetNotificationPreferences)
+	auth.PUT("/notification-preferences", notificationHandler.UpdateNotificationPreferences)
+	auth.POST("/timesheets", timesheetHandler.SubmitTimesheet)
+	auth.GET("/timesheets/my", timesheetHandler.GetMyTimesheets)
+	auth.GET("/timesheets/pending-approval", timesheetHandler.GetPendingTimesheets)
+	auth.GET("/timesheets/:id", timesheetHandler.GetTimesheet)
+	auth.PUT("/timesheets/:id/approve", timesheetHandler.ApproveTimesheet)
+	auth.POST("/timesheets/:id/reopen", timesheetHandler.ReopenTimesheet)
+	auth.POST("/approval-delegations", delegationHandler.CreateDelegation)
+	auth.GET("/approval-delegations/my", delegationHandler.GetMyDelegations)
+	auth.DELETE("/approval-delegations/:id", delegationHandler.DeleteDelegation)
 	admin := auth.Group("")
 	admin.Use(middleware.AdminMiddleware())
 	admin.GET("/users", userHandler.GetUsers)
 	admin.POST("/users", userHandler.CreateUser)
 	admin.DELETE("/users/:id", userHandler.DeleteUser)
+	admin.PUT("/users/:id/attendance-modes", userHandler.UpdateAttendanceModes)
+	admin.PUT("/users/:id/manager", userHandler.UpdateManager)
 	admin.GET("/attendance", attendanceHandler.GetAllAttendance)
+	admin.GET("/attendance/export", attendanceHandler.ExportAllAttendance)
+	admin.POST("/attendance/:id/correction-request", attendanceHandler.RequestCorrection)
 	admin.GET("/leave-requests", leaveHandler.GetAllLeaveRequests)
-	admin.PUT("/leave-requests/:id/approve", leaveHandler.ApproveLeaveRequest)
+	admin.GET("/leave-requests/export", leaveHandler.ExportAllLeaveRequests)
 	admin.GET("/leave-balances", leaveHandler.GetAllLeaveBalances)
+	admin.GET("/leave-balances/export", leaveHandler.ExportAllLeaveBalances)
 	admin.PUT("/leave-balances", leaveHandler.UpdateLeaveBalance)
+	admin.PUT("/leave-type-policies/:type", leaveHandler.UpdateLeaveTypePolicy)
+	admin.POST("/holidays", holidayHandler.CreateHoliday)
+	admin.DELETE("/holidays/:date", holidayHandler.DeleteHoliday)
+	admin.GET("/approval-rules", approvalRuleHandler.GetApprovalRules)
+	admin.POST("/approval-rules", approvalRuleHandler.CreateApprovalRule)
+	admin.PUT("/approval-rules/:id", approvalRuleHandler.UpdateApprovalRule)
+	admin.DELETE("/approval-rules/:id", approvalRuleHandler.DeleteApprovalRule)
+	admin.GET("/webhooks/events", webhookHandler.GetWebhookEvents)
+	admin.GET("/webhooks", webhookHandler.GetWebhooks)
+	admin.POST("/webhooks", webhookHandler.CreateWebhook)
+	admin.PUT("/webhooks/:id", webhookHandler.UpdateWebhook)
+	admin.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+	admin.GET("/webhook-deliveries", webhookHandler.GetWebhookDeliveries)
+	admin.POST("/webhook-deliveries/:id/redeliver", webhookHandler.RedeliverWebhook)
+	admin.GET("/chat-channels", chatChannelHandler.GetChatChannels)
+	admin.POST("/chat-channels", chatChannelHandler.CreateChatChannel)
+	admin.PUT("/chat-channels/:id", chatChannelHandler.UpdateChatChannel)
+	admin.DELETE("/chat-channels/:id", chatChannelHandler.DeleteChatChannel)
+	admin.POST("/chat-channels/:id/test", chatChannelHandler.TestChatChannel)
+	admin.GET("/payroll-periods", payrollHandler.GetPayrollPeriods)
+	admin.POST("/payroll-periods", payrollHandler.CreatePayrollPeriod)
+	admin.POST("/payroll-periods/:id/lock", payrollHandler.LockPayrollPeriod)
+	admin.POST("/payroll-periods/:id/reopen", payrollHandler.ReopenPayrollPeriod)
+	admin.GET("/payroll-periods/:id/summary", payrollHandler.GetPayrollSummary)
+	admin.GET("/payroll-periods/:id/export", payrollHandler.ExportPayroll)
+	admin.GET("/payroll-fields", payrollHandler.GetPayrollFields)
+	admin.GET("/payroll-templates", payrollHandler.GetPayrollTemplates)
+	admin.POST("/payroll-templates", payrollHandler.CreatePayrollTemplate)
+	admin.PUT("/payroll-templates/:id", payrollHandler.UpdatePayrollTemplate)
+	admin.DELETE("/payroll-templates/:id", payrollHandler.DeletePayrollTemplate)
+	admin.POST("/projects", projectHandler.CreateProject)
+	admin.PUT("/projects/:id", projectHandler.UpdateProject)
+	admin.DELETE("/projects/:id", projectHandler.DeleteProject)
+	admin.GET("/reports/project-hours", projectHandler.GetProjectHoursReport)
+	admin.GET("/stats/overview", statsHandler.GetOverview)
+	admin.GET("/attendance-anomalies", anomalyHandler.GetAnomalies)
+	admin.POST("/attendance-anomalies/scan", anomalyHandler.ScanAnomalies)
+	admin.PUT("/attendance-anomalies/:id/review", anomalyHandler.ReviewAnomaly)
+	admin.GET("/devices", deviceHandler.GetDevices)
+	admin.PUT("/devices/:id/status", deviceHandler.ReviewDevice)
+	admin.DELETE("/devices/:id", deviceHandler.DeleteDevice)
+	admin.POST("/departments", departmentHandler.CreateDepartment)
+	admin.PUT("/departments/:id", departmentHandler.UpdateDepartment)
+	admin.DELETE("/departments/:id", departmentHandler.DeleteDepartment)
 }
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"errors"
+	"io"
+
+	"greentech-attendance/config"
+)
+
+// ErrNotFound 表示文件不存在
+var ErrNotFound = errors.New("file not found")
+
+// Storage 附件存储接口，key 由调用方生成且只包含安全字符
+type Storage interface {
+	Save(key string, r io.Reader, size int64, contentType string) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// New 根据配置创建存储实现，默认使用本地文件系统
+func New(cfg *config.Config) Storage {
+	if cfg.StorageDriver == "s3" {
+		return NewS3Storage(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey)
+	}
+	return &LocalStorage{BaseDir: cfg.StorageLocalDir}
+}
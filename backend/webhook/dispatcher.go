@@ -0,0 +1,254 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// MaxAttempts 超过该次数仍失败的投递标记为 failed，可手动重新投递
+	MaxAttempts = 8
+	// 首次重试间隔，之后每次翻倍
+	baseRetryDelay = 30 * time.Second
+	maxRetryDelay  = 6 * time.Hour
+	// 投递被领取后的租约时间，进程在投递中崩溃时到期后会被重新领取
+	deliveryLease = 5 * time.Minute
+)
+
+// Dispatcher 轮询发件箱，将事件扇出到订阅的端点并投递，失败时按指数退避重试
+type Dispatcher struct {
+	DB       *sql.DB
+	Client   *http.Client
+	Interval time.Duration
+}
+
+func NewDispatcher(db *sql.DB) *Dispatcher {
+	return &Dispatcher{
+		DB:       db,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		Interval: 5 * time.Second,
+	}
+}
+
+func (d *Dispatcher) Start() {
+	go func() {
+		for {
+			if err := d.fanOut(); err != nil {
+				log.Printf("webhook fan-out failed: %v", err)
+			}
+			if err := d.deliverDue(); err != nil {
+				log.Printf("webhook delivery failed: %v", err)
+			}
+			time.Sleep(d.Interval)
+		}
+	}()
+}
+
+// Sign 计算签名：HMAC-SHA256(secret, timestamp + "." + body)，接收方用同样方式校验
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// fanOut 为发件箱中未处理的事件给每个订阅的端点生成一条投递记录
+func (d *Dispatcher) fanOut() error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, event_type FROM outbox_events
+		WHERE dispatched_at IS NULL
+		ORDER BY id
+		LIMIT 100
+		FOR UPDATE SKIP LOCKED
+	`)
+	if err != nil {
+		return err
+	}
+	type event struct {
+		id        int
+		eventType string
+	}
+	events := []event{}
+	for rows.Next() {
+		var e event
+		if err := rows.Scan(&e.id, &e.eventType); err != nil {
+			rows.Close()
+			return err
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if len(events) == 0 {
+		return nil
+	}
+
+	ids := []int{}
+	for _, e := range events {
+		_, err := tx.Exec(`
+			INSERT INTO webhook_deliveries (endpoint_id, event_id)
+			SELECT id, $1 FROM webhook_endpoints
+			WHERE active AND $2 = ANY(events)
+		`, e.id, e.eventType)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, e.id)
+	}
+	_, err = tx.Exec(`
+		UPDATE outbox_events SET dispatched_at = CURRENT_TIMESTAMP WHERE id = ANY($1)
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deliverDue 领取到期的投递并逐条发送
+func (d *Dispatcher) deliverDue() error {
+	rows, err := d.DB.Query(`
+		UPDATE webhook_deliveries
+		SET next_attempt_at = CURRENT_TIMESTAMP + $1 * interval '1 second'
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT 20
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`, deliveryLease.Seconds())
+	if err != nil {
+		return err
+	}
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := d.deliver(id); err != nil {
+			log.Printf("webhook delivery %d failed: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) deliver(deliveryID int) error {
+	var url, secret, eventType string
+	var eventID, attempts int
+	var payload []byte
+	var createdAt time.Time
+	err := d.DB.QueryRow(`
+		SELECT e.url, e.secret, o.id, o.event_type, o.payload, o.created_at, w.attempts
+		FROM webhook_deliveries w
+		JOIN webhook_endpoints e ON e.id = w.endpoint_id
+		JOIN outbox_events o ON o.id = w.event_id
+		WHERE w.id = $1
+	`, deliveryID).Scan(&url, &secret, &eventID, &eventType, &payload, &createdAt, &attempts)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":         eventID,
+		"event":      eventType,
+		"created_at": createdAt,
+		"data":       json.RawMessage(payload),
+	})
+	if err != nil {
+		return err
+	}
+
+	statusCode, response, sendErr := d.send(url, secret, eventType, deliveryID, body)
+	attempts++
+
+	if sendErr == nil {
+		_, err = d.DB.Exec(`
+			UPDATE webhook_deliveries
+			SET status = 'success', attempts = $1, last_status_code = $2, last_response = $3,
+				last_error = NULL, delivered_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $4
+		`, attempts, statusCode, response, deliveryID)
+		return err
+	}
+
+	status := "pending"
+	if attempts >= MaxAttempts {
+		status = "failed"
+	}
+	_, err = d.DB.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, last_status_code = $3, last_response = $4, last_error = $5,
+			next_attempt_at = CURRENT_TIMESTAMP + $6 * interval '1 second', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7
+	`, status, attempts, sql.NullInt64{Int64: int64(statusCode), Valid: statusCode != 0}, response,
+		sendErr.Error(), retryDelay(attempts).Seconds(), deliveryID)
+	return err
+}
+
+// send 发送一次请求，非2xx响应视为失败
+func (d *Dispatcher) send(url, secret, eventType string, deliveryID int, body []byte) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GreenTech-Webhook/1.0")
+	req.Header.Set("X-GreenTech-Event", eventType)
+	req.Header.Set("X-GreenTech-Delivery", strconv.Itoa(deliveryID))
+	req.Header.Set("X-GreenTech-Timestamp", timestamp)
+	req.Header.Set("X-GreenTech-Signature", Sign(secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	// 只保留响应的前1KB用于排查
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	snippet := strings.ToValidUTF8(string(raw), "")
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, snippet, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, snippet, nil
+}
+
+// retryDelay 第n次失败后的重试间隔：30s、1m、2m……最长6小时
+func retryDelay(attempts int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
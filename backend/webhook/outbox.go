@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// 可订阅的事件类型
+const (
+	EventAttendanceCheckedIn = "attendance.checked_in"
+	EventLeaveApproved       = "leave.approved"
+	EventUserCreated         = "user.created"
+)
+
+// Events 所有可订阅的事件
+var Events = []string{
+	EventAttendanceCheckedIn,
+	EventLeaveApproved,
+	EventUserCreated,
+}
+
+// Execer 由 *sql.DB 和 *sql.Tx 实现
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Enqueue 将事件写入发件箱。调用方应在写业务数据的同一事务中调用，
+// 事务提交后由 Dispatcher 投递，进程崩溃也不会丢失事件
+func Enqueue(db Execer, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO outbox_events (event_type, payload) VALUES ($1, $2)
+	`, eventType, payload)
+	return err
+}
@@ -6,10 +6,15 @@ export interface User {
     phone?: string;
     role: string;
     department?: string;
+    department_id?: number | null;
+    manager_id?: number | null;
     position?: string;
+    attendance_modes?: AttendanceMode[];
     created_at?: string;
 }
 
+export type AttendanceMode = 'office' | 'remote' | 'field';
+
 export interface AttendanceRecord {
     id: number;
     user_id: number;
@@ -21,17 +26,34 @@ export interface AttendanceRecord {
     status: string;
     notes?: string;
     location?: string;
+    mode?: AttendanceMode;
+    project_id?: number;
+    device_flagged?: boolean;
+    field_visits?: number;
     created_at: string;
 }
 
+export interface FieldVisit {
+    id: number;
+    attendance_record_id: number;
+    location: string;
+    customer?: string;
+    note?: string;
+    visited_at: string;
+}
+
 export interface LeaveRequest {
     id: number;
     user_id: number;
     user_name?: string;
     leave_type: string;
+    destination?: string;
     start_date: string;
     end_date: string;
+    start_time?: string;
+    end_time?: string;
     days: number;
+    hours?: number;
     reason?: string;
     status: string;
     approver_id?: number;
@@ -39,6 +61,12 @@ export interface LeaveRequest {
     approved_at?: string;
     approval_notes?: string;
     remark?: string;
+    cancel_end_date?: string;
+    cancel_days?: number;
+    cancel_reason?: string;
+    coverage_conflicts?: { date: string; off_count: number }[];
+    current_step?: number;
+    charges?: { year: number; days: number }[];
     created_at: string;
     updated_at: string;
 }
@@ -53,4 +81,86 @@ export interface LeaveBalance {
     annual_leave: number;
     sick_leave: number;
     personal_leave: number;
+    hours_per_day?: number;
+    annual_leave_hours?: number;
+    sick_leave_hours?: number;
+    personal_leave_hours?: number;
+}
+
+export interface Notification {
+    id: number;
+    event: string;
+    title: string;
+    body: string;
+    link: string;
+    read_at?: string;
+    created_at: string;
+}
+
+export interface NotificationPreference {
+    event: string;
+    in_app: boolean;
+    email: boolean;
+}
+
+export interface DailyStats {
+    date: string;
+    checked_in: number;
+    late: number;
+    on_leave: number;
+}
+
+export interface DepartmentStats {
+    department_id?: number | null;
+    department: string;
+    headcount: number;
+    checked_in: number;
+    late: number;
+    on_leave: number;
+}
+
+export interface StatsOverview {
+    date: string;
+    headcount: number;
+    checked_in: number;
+    late: number;
+    on_leave: number;
+    on_trip: number;
+    pending_approvals: {
+        leave_requests: number;
+        cancellations: number;
+        timesheets: number;
+    };
+    trend: DailyStats[];
+    departments: DepartmentStats[];
+}
+
+export interface Department {
+    id: number;
+    name: string;
+    parent_id: number | null;
+    head_user_id: number | null;
+    head_name?: string;
+    path: string[];
+    member_count: number;
+    created_at: string;
+    updated_at: string;
+}
+
+export interface OrgMember {
+    id: number;
+    name: string;
+    department: string;
+    position: string;
+    manager_id: number | null;
+    direct: boolean;
+}
+
+export interface OrgNode {
+    id: number;
+    name: string;
+    department: string;
+    position: string;
+    manager_id: number | null;
+    reports: OrgNode[];
 }